@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"personalization-content-converter/utils"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - Server settings. Each setting is a flag (-read-timeout), an environment
+// variable (CONVERTER_READ_TIMEOUT) and a config file key (read_timeout); flags win over
+// the environment, which wins over the file.
+type Config struct {
+	Addr         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	MaxBodyBytes int64
+
+	LogLevel  string
+	LogFormat string
+
+	// Feature toggles
+	ValidateSchemas bool
+	SessionTracking bool
+	AdminEndpoints  bool
+
+	MappingsFile          string
+	MappingsWatchInterval time.Duration
+
+	IdentityStore      string
+	IdentityStoreFile  string
+	IdentityStoreLimit int
+
+	EchoRequest      string
+	RedactionRules   string
+	RedactionHashKey string
+
+	// Source of each setting: default, file, env or flag
+	sources map[string]string
+	flagSet *flag.FlagSet
+}
+
+// Setting sources
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// envPrefix starts the environment variables of the settings, keeping them apart from
+// those of other services
+const envPrefix = "CONVERTER_"
+
+// The flag and environment variable naming the config file
+const (
+	configFileFlag = "config"
+	configFileEnv  = envPrefix + "CONFIG_FILE"
+)
+
+// secretSettings are elided from the /config dump
+var secretSettings = map[string]bool{
+	"redaction-hash-key": true,
+}
+
+// Identity stores
+const (
+	identityStoreNone   = ""
+	identityStoreMemory = "memory"
+	identityStoreFile   = "file"
+)
+
+// newConfig returns a config holding the defaults, with every setting bound to a flag
+func newConfig() *Config {
+	c := &Config{sources: map[string]string{}}
+	c.flagSet = c.flags()
+	c.flagSet.VisitAll(func(f *flag.Flag) {
+		c.sources[f.Name] = sourceDefault
+	})
+	return c
+}
+
+// flags binds every setting to a flag of the config, with its default
+func (c *Config) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("converter", flag.ContinueOnError)
+	fs.String(configFileFlag, "", "YAML config file")
+
+	fs.StringVar(&c.Addr, "addr", ":8080", "listen address")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", 10*time.Second, "maximum duration for reading a request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", 30*time.Second, "maximum duration for writing a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", 120*time.Second, "maximum time to wait for the next request on a keep-alive connection")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", 1<<20, "maximum request body size in bytes")
+
+	fs.StringVar(&c.LogLevel, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", "json", "log format: json or text")
+
+	fs.BoolVar(&c.ValidateSchemas, "validate-schemas", false, "validate translations against the format schemas by default")
+	fs.BoolVar(&c.SessionTracking, "session-tracking", true, "carry derived sessions across requests until the visitor is inactive for 30 minutes")
+	fs.BoolVar(&c.AdminEndpoints, "admin-endpoints", false, "serve the /admin and /config endpoints")
+
+	fs.StringVar(&c.MappingsFile, "mappings-file", "", "mappings file replacing the built-in mappings")
+	fs.DurationVar(&c.MappingsWatchInterval, "mappings-watch-interval", 5*time.Second, "interval between mappings file checks; 0 reloads on SIGHUP only")
+
+	fs.StringVar(&c.IdentityStore, "identity-store", identityStoreNone, "identity store linking user IDs across formats: memory or file")
+	fs.StringVar(&c.IdentityStoreFile, "identity-store-file", "", "append-only log of the file identity store")
+	fs.IntVar(&c.IdentityStoreLimit, "identity-store-limit", utils.DefaultIdentityStoreLimit, "identifiers the identity store holds before forgetting the least recently linked; 0 is unbounded")
+
+	fs.StringVar(&c.EchoRequest, "echo-request", echoRedacted, "how responses echo the translated request: full, redacted or none")
+	fs.StringVar(&c.RedactionRules, "redaction-rules", "", "key=mode redaction rules overriding the defaults, comma-separated; dotted keys such as user.id match paths")
+	fs.StringVar(&c.RedactionHashKey, "redaction-hash-key", "", "key of the hashes redaction produces")
+
+	fs.Usage = func() { usage(fs) }
+	return fs
+}
+
+// usage prints the flags, then the environment variable of each
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", fs.Name())
+	fs.PrintDefaults()
+
+	fmt.Fprintf(out, "\nEnvironment variables, overridden by flags and overriding the config file:\n")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s\t-%s\n", configFileEnv, configFileFlag)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != configFileFlag {
+			fmt.Fprintf(w, "  %s\t-%s\n", envName(f.Name), f.Name)
+		}
+	})
+	w.Flush()
+}
+
+// loadConfig builds the config from the defaults, the config file named by -config or
+// CONFIG_FILE, the environment and the command line arguments, then validates it
+func loadConfig(args []string, getenv func(string) string) (*Config, error) {
+	// Parse the flags into a scratch config first: they apply last, over the file and
+	// the environment
+	fs := newConfig().flagSet
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	flagValues := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flagValues[f.Name] = f.Value.String()
+	})
+
+	config := newConfig()
+	fs = config.flagSet
+
+	path := flagValues[configFileFlag]
+	if path == "" {
+		path = getenv(configFileEnv)
+	}
+	if path != "" {
+		if err := config.applyFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFileFlag {
+			return
+		}
+		if value := getenv(envName(f.Name)); value != "" {
+			if err := fs.Set(f.Name, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", envName(f.Name), err))
+				return
+			}
+			config.sources[f.Name] = sourceEnv
+		}
+	})
+	for name, value := range flagValues {
+		fs.Set(name, value)
+		config.sources[name] = sourceFlag
+	}
+	if len(problems) > 0 {
+		return nil, errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	// A store file alone selects the file store
+	if config.IdentityStore == identityStoreNone && config.IdentityStoreFile != "" {
+		config.IdentityStore = identityStoreFile
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyFile sets the settings found in a YAML config file
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var problems []string
+	for key, value := range settings {
+		name := strings.ReplaceAll(key, "_", "-")
+		if c.flagSet.Lookup(name) == nil || name == configFileFlag {
+			problems = append(problems, fmt.Sprintf("unknown setting %q", key))
+			continue
+		}
+		if err := c.flagSet.Set(name, fmt.Sprint(value)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		c.sources[name] = sourceFile
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid config file %s: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validate checks the settings against each other and their allowed values
+func (c *Config) validate() error {
+	var problems []string
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("addr: %v", err))
+	}
+	for name, timeout := range map[string]time.Duration{
+		"read-timeout":            c.ReadTimeout,
+		"write-timeout":           c.WriteTimeout,
+		"idle-timeout":            c.IdleTimeout,
+		"mappings-watch-interval": c.MappingsWatchInterval,
+	} {
+		if timeout < 0 {
+			problems = append(problems, fmt.Sprintf("%s: must not be negative", name))
+		}
+	}
+	if c.IdentityStoreLimit < 0 {
+		problems = append(problems, "identity-store-limit: must not be negative")
+	}
+	if c.MaxBodyBytes <= 0 {
+		problems = append(problems, "max-body-bytes: must be positive")
+	}
+	if _, err := c.level(); err != nil {
+		problems = append(problems, fmt.Sprintf("log-level: %v", err))
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		problems = append(problems, fmt.Sprintf("log-format: unsupported format %q, want json or text", c.LogFormat))
+	}
+	switch c.IdentityStore {
+	case identityStoreNone, identityStoreMemory:
+	case identityStoreFile:
+		if c.IdentityStoreFile == "" {
+			problems = append(problems, "identity-store: the file store needs identity-store-file")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("identity-store: unsupported store %q, want memory or file", c.IdentityStore))
+	}
+	switch c.EchoRequest {
+	case echoFull, echoRedacted, echoNone:
+	default:
+		problems = append(problems, fmt.Sprintf("echo-request: unsupported mode %q, want %s, %s or %s", c.EchoRequest, echoFull, echoRedacted, echoNone))
+	}
+	if _, err := utils.ParseRedactionRules(c.RedactionRules); err != nil {
+		problems = append(problems, fmt.Sprintf("redaction-rules: %v", err))
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// level returns the slog level of the log-level setting
+func (c *Config) level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// ConfigSetting - A setting in the /config dump
+type ConfigSetting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// dump returns every setting by flag name, with secrets elided
+func (c *Config) dump() map[string]ConfigSetting {
+	settings := map[string]ConfigSetting{}
+	c.flagSet.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFileFlag {
+			return
+		}
+		value := f.Value.String()
+		if secretSettings[f.Name] && value != "" {
+			value = "<redacted>"
+		}
+		settings[f.Name] = ConfigSetting{Value: value, Source: c.sources[f.Name]}
+	})
+	return settings
+}
+
+// envName returns the environment variable of a setting, e.g. CONVERTER_READ_TIMEOUT for
+// read-timeout
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "addr: \":9000\"\nread_timeout: 3s\nmax_body_bytes: 2048\nlog_level: debug\nvalidate_schemas: true\n"
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(
+		[]string{"-config", path, "-addr", ":9100"},
+		env(map[string]string{"CONVERTER_ADDR": ":9050", "CONVERTER_READ_TIMEOUT": "4s", "CONVERTER_REDACTION_HASH_KEY": "secret"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Addr != ":9100" || config.ReadTimeout != 4*time.Second || config.MaxBodyBytes != 2048 ||
+		config.LogLevel != "debug" || !config.ValidateSchemas || config.WriteTimeout != 30*time.Second {
+		t.Errorf("config = %+v", config)
+	}
+
+	dump := config.dump()
+	for name, want := range map[string]ConfigSetting{
+		"addr":               {Value: ":9100", Source: sourceFlag},
+		"read-timeout":       {Value: "4s", Source: sourceEnv},
+		"max-body-bytes":     {Value: "2048", Source: sourceFile},
+		"write-timeout":      {Value: "30s", Source: sourceDefault},
+		"redaction-hash-key": {Value: "<redacted>", Source: sourceEnv},
+	} {
+		if dump[name] != want {
+			t.Errorf("%s = %+v, want %+v", name, dump[name], want)
+		}
+	}
+	if _, exists := dump[configFileFlag]; exists {
+		t.Error("config file flag dumped")
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		problem string
+	}{
+		{"bad address", []string{"-addr", "8080"}, nil, "addr:"},
+		{"negative timeout", []string{"-idle-timeout", "-1s"}, nil, "idle-timeout: must not be negative"},
+		{"empty body limit", nil, map[string]string{"CONVERTER_MAX_BODY_BYTES": "0"}, "max-body-bytes: must be positive"},
+		{"log level", []string{"-log-level", "loud"}, nil, "log-level:"},
+		{"log format", []string{"-log-format", "xml"}, nil, "log-format:"},
+		{"file store without a file", []string{"-identity-store", "file"}, nil, "needs identity-store-file"},
+		{"echo mode", nil, map[string]string{"CONVERTER_ECHO_REQUEST": "bogus"}, "echo-request:"},
+		{"redaction rules", []string{"-redaction-rules", "user_id=scramble"}, nil, "redaction-rules:"},
+		{"malformed env", nil, map[string]string{"CONVERTER_VALIDATE_SCHEMAS": "yes please"}, "CONVERTER_VALIDATE_SCHEMAS:"},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(tt.args, env(tt.env))
+		if err == nil || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.problem)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("listen_port: 80\n"), 0o644)
+	if _, err := loadConfig(nil, env(map[string]string{"CONVERTER_CONFIG_FILE": path})); err == nil || !strings.Contains(err.Error(), `unknown setting "listen_port"`) {
+		t.Errorf("unknown file setting: error = %v", err)
+	}
+}
+
+func TestLoadConfigIdentityStoreFile(t *testing.T) {
+	config, err := loadConfig(nil, env(map[string]string{"CONVERTER_IDENTITY_STORE_FILE": "/tmp/identities.json"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IdentityStore != identityStoreFile {
+		t.Errorf("identity store = %q, want the file store", config.IdentityStore)
+	}
+}
+
+func TestLoadConfigAdminEndpointsOptIn(t *testing.T) {
+	config, err := loadConfig(nil, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AdminEndpoints {
+		t.Error("admin endpoints served by default")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("admin_endpoints: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for source, args := range map[string][]string{
+		sourceFlag: {"-admin-endpoints"},
+		sourceFile: {"-config", path},
+		sourceEnv:  nil,
+	} {
+		variables := map[string]string{}
+		if source == sourceEnv {
+			variables["CONVERTER_ADMIN_ENDPOINTS"] = "true"
+		}
+		config, err := loadConfig(args, env(variables))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !config.AdminEndpoints || config.dump()["admin-endpoints"].Source != source {
+			t.Errorf("%s: admin endpoints = %+v, want enabled", source, config.dump()["admin-endpoints"])
+		}
+	}
+}
+
+func TestUsageListsEnvironmentVariables(t *testing.T) {
+	fs := newConfig().flagSet
+	var out strings.Builder
+	fs.SetOutput(&out)
+	fs.Usage()
+
+	for _, want := range []string{"-read-timeout", "CONVERTER_CONFIG_FILE", "CONVERTER_READ_TIMEOUT", "CONVERTER_ADMIN_ENDPOINTS"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("usage lacks %s:\n%s", want, out.String())
+		}
+	}
+}
@@ -1,24 +1,77 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"personalization-content-converter/utils"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
+var registry = utils.NewDefaultRegistry()
+
+var schemas = mustLoadSchemas()
+
+// config holds the server settings loaded at startup
+var config = newConfig()
+
+// mappingReloader reloads the mappings file; nil when the built-in mappings are used
+var mappingReloader *utils.MappingReloader
+
+// redactor rewrites personal data in log attributes and echoed requests
+var redactor = utils.NewRedactor(utils.DefaultRedactionRules, "")
+
+// How translation responses echo the translated request, set with -echo-request
+const (
+	echoFull     = "full"     // The request as received
+	echoRedacted = "redacted" // The request with the redaction rules applied
+	echoNone     = "none"     // No request
+)
+
+var echoMode = echoRedacted
+
+func mustLoadSchemas() *utils.SchemaRegistry {
+	schemas, err := utils.NewDefaultSchemaRegistry()
+	if err != nil {
+		slog.Error("Failed to load schemas", "error", err.Error())
+		os.Exit(1)
+	}
+	return schemas
+}
+
 type HealthResponse struct {
 	Status string `json:"status"`
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error      string            `json:"error"`
+	Supported  []string          `json:"supported,omitempty"`
+	Stage      string            `json:"stage,omitempty"`
+	Violations []utils.Violation `json:"violations,omitempty"`
+}
+
+type MappingsResponse struct {
+	Path     string               `json:"path,omitempty"`
+	Mappings *utils.MappingConfig `json:"mappings"`
+}
+
+type ConfigResponse struct {
+	Settings map[string]ConfigSetting `json:"settings"`
 }
 
 type TranslationResponse struct {
-	Request  interface{} `json:"request"`
+	Request  interface{} `json:"request,omitempty"`
 	Response interface{} `json:"response"`
 }
 
@@ -39,373 +92,670 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
-func uoToCommonRequestHandler(w http.ResponseWriter, r *http.Request) {
+// translateHandler serves every registered translation pair. The pair is taken either from
+// /translate/{kind}/{from}/{to} or from the combined /translate/{kind}/{from}-to-{to} form.
+func translateHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	w.Header().Set("Content-Type", "application/json")
 
-	var uoRequest utils.UOCurrentRequestFormat
-	if err := json.NewDecoder(r.Body).Decode(&uoRequest); err != nil {
+	kind := utils.Kind(r.PathValue("kind"))
+	from, to := r.PathValue("from"), r.PathValue("to")
+	if pair := r.PathValue("pair"); pair != "" {
+		from, to, _ = strings.Cut(pair, "-to-")
+	}
+
+	translator, err := registry.Lookup(kind, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error(), Supported: supportedRoutes()})
+
+		slog.Warn("Translation failed - unsupported pair",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+			"status", 404,
+			"kind", kind,
+			"from", from,
+			"to", to,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return
+	}
+
+	ctx, err := brandContext(r)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error(), Supported: utils.CurrentMappings().BrandNames()})
 
-		slog.Error("UO to Common request translation failed - invalid JSON",
+		slog.Warn("Translation failed - unknown brand",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
 			"status", 400,
-			"error", err.Error(),
+			"kind", kind,
+			"from", from,
+			"to", to,
+			"brand", r.Header.Get(brandHeader),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
+	ctx = sessionContext(ctx, r)
+
+	// Schema validation runs on the raw document, before typed decoding fills in zero values
+	var raw interface{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.NewDecoder(bytes.NewReader(body)).Decode(&raw)
+	}
+	if err != nil {
+		invalidJSON(w, r, start, kind, from, to, err)
+		return
+	}
+
+	validate := validationEnabled(r)
+	if validate && !checkSchema(w, r, start, "input", kind, from, to, raw) {
+		return
+	}
+
+	input, err := registry.NewPayload(kind, from)
+	if err == nil {
+		err = json.NewDecoder(bytes.NewReader(body)).Decode(input)
+	}
+	if err != nil {
+		invalidJSON(w, r, start, kind, from, to, err)
+		return
+	}
 
-	translator := &utils.UOToCommonTranslator{}
-	commonRequest, err := translator.Translate(&uoRequest)
+	output, err := translator.Translate(ctx, input)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 
-		slog.Error("UO to Common request translation failed - translator error",
+		slog.Error("Translation failed - translator error",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
 			"status", 500,
+			"kind", kind,
+			"from", from,
+			"to", to,
 			"error", err.Error(),
-			"user_id", uoRequest.IsEvent.User.ID,
+			"user_id", userID(input),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
+	if validate && !checkSchema(w, r, start, "output", kind, from, to, output) {
+		return
+	}
+
 	response := TranslationResponse{
-		Request:  uoRequest,
-		Response: commonRequest,
+		Request:  echoRequest(input),
+		Response: output,
 	}
 	json.NewEncoder(w).Encode(response)
 
-	slog.Info("UO to Common request translation successful",
+	slog.Info("Translation successful",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent(),
 		"status", 200,
-		"user_id", uoRequest.IsEvent.User.ID,
-		"action", uoRequest.IsEvent.Action,
+		"kind", kind,
+		"from", from,
+		"to", to,
+		"user_id", userID(input),
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 }
 
-func commonToUoRequestHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	w.Header().Set("Content-Type", "application/json")
-
-	var commonRequest utils.CommonRequestFormat
-	if err := json.NewDecoder(r.Body).Decode(&commonRequest); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+func invalidJSON(w http.ResponseWriter, r *http.Request, start time.Time, kind utils.Kind, from, to string, err error) {
+	if tooLarge, ok := bodyTooLarge(err); ok {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: tooLarge})
 
-		slog.Error("Common to UO request translation failed - invalid JSON",
+		slog.Warn("Translation failed - request body too large",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 400,
-			"error", err.Error(),
+			"status", 413,
+			"kind", kind,
+			"from", from,
+			"to", to,
+			"max_body_bytes", config.MaxBodyBytes,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	translator := &utils.CommonToUOTranslator{}
-	uoRequest, err := translator.Translate(&commonRequest)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
 
-		slog.Error("Common to UO request translation failed - translator error",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"remote_addr", r.RemoteAddr,
-			"user_agent", r.UserAgent(),
-			"status", 500,
-			"error", err.Error(),
-			"user_id", commonRequest.User.ID,
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-		return
+	slog.Error("Translation failed - invalid JSON",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"status", 400,
+		"kind", kind,
+		"from", from,
+		"to", to,
+		"error", err.Error(),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
+
+// bodyTooLarge returns the error message for a request body over the size limit
+func bodyTooLarge(err error) (string, bool) {
+	var maxBytes *http.MaxBytesError
+	if !errors.As(err, &maxBytes) {
+		return "", false
 	}
+	return fmt.Sprintf("Request body exceeds %d bytes", maxBytes.Limit), true
+}
 
-	response := TranslationResponse{
-		Request:  commonRequest,
-		Response: uoRequest,
+// brandHeader names a brand profile explicitly, overriding detection from the payload
+const brandHeader = "X-Brand"
+
+// brandContext returns the request context carrying the brand named in the X-Brand header
+func brandContext(r *http.Request) (context.Context, error) {
+	brand := r.Header.Get(brandHeader)
+	if brand == "" {
+		return r.Context(), nil
+	}
+	if _, err := utils.CurrentMappings().ForBrand(brand); err != nil {
+		return nil, err
+	}
+	return utils.WithBrand(r.Context(), brand), nil
+}
+
+// sessionHeader carries the caller's session ID; the session cookies are read otherwise
+const sessionHeader = "X-Session-ID"
+
+// sessionContext returns ctx carrying the session ID from the X-Session-ID header or a
+// session cookie, if the request has one
+func sessionContext(ctx context.Context, r *http.Request) context.Context {
+	if sessionID := r.Header.Get(sessionHeader); sessionID != "" {
+		return utils.WithSessionID(ctx, sessionID)
+	}
+	for _, name := range utils.SessionCookies {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return utils.WithSessionID(ctx, cookie.Value)
+		}
+	}
+	return ctx
+}
+
+// validationEnabled reports whether schema validation applies to a request. The
+// validate-schemas default can be overridden per request with ?validate=true|false.
+func validationEnabled(r *http.Request) bool {
+	if value, err := strconv.ParseBool(r.URL.Query().Get("validate")); err == nil {
+		return value
+	}
+	return config.ValidateSchemas
+}
+
+// checkSchema validates a translation input or output against the schema of its format,
+// writing a 422 response listing the violations when it does not conform
+func checkSchema(w http.ResponseWriter, r *http.Request, start time.Time, stage string, kind utils.Kind, from, to string, payload interface{}) bool {
+	format := from
+	if stage == "output" {
+		format = to
+	}
+
+	violations, err := schemas.Validate(kind, format, payload)
+	if err == nil && len(violations) == 0 {
+		return true
 	}
+
+	response := ErrorResponse{Error: "Schema validation failed", Stage: stage, Violations: violations}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
 	json.NewEncoder(w).Encode(response)
 
-	slog.Info("Common to UO request translation successful",
+	slog.Warn("Translation failed - schema validation",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent(),
-		"status", 200,
-		"user_id", commonRequest.User.ID,
-		"event_type", commonRequest.Event.Type,
+		"status", 422,
+		"kind", kind,
+		"from", from,
+		"to", to,
+		"stage", stage,
+		"violations", len(violations),
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
+	return false
 }
 
-func commonToIsResponseHandler(w http.ResponseWriter, r *http.Request) {
+// verifyRoundTripHandler translates the posted payload to Common and back and reports the
+// differences. The kind defaults to request and can be set with ?kind=response.
+func verifyRoundTripHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	w.Header().Set("Content-Type", "application/json")
 
-	var commonResponse utils.CommonResponseFormat
-	if err := json.NewDecoder(r.Body).Decode(&commonResponse); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
-		
-		slog.Error("Common to IS response translation failed - invalid JSON",
+	format := r.PathValue("format")
+	kind := utils.KindRequest
+	if value := r.URL.Query().Get("kind"); value != "" {
+		kind = utils.Kind(value)
+	}
+
+	input, err := registry.NewPayload(kind, format)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error(), Supported: supportedRoutes()})
+
+		slog.Warn("Round trip verification failed - unknown format",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 400,
-			"error", err.Error(),
+			"status", 404,
+			"kind", kind,
+			"format", format,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	translator := &utils.CommonToISResponseTranslator{}
-	isResponse, err := translator.Translate(&commonResponse)
+	// The report diffs against the body as sent, so keep it
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, input)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		
-		slog.Error("Common to IS response translation failed - translator error",
+		if tooLarge, ok := bodyTooLarge(err); ok {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: tooLarge})
+
+			slog.Warn("Round trip verification failed - request body too large",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote_addr", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+				"status", 413,
+				"kind", kind,
+				"format", format,
+				"max_body_bytes", config.MaxBodyBytes,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+
+		slog.Error("Round trip verification failed - invalid JSON",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 500,
+			"status", 400,
+			"kind", kind,
+			"format", format,
 			"error", err.Error(),
-			"request_id", commonResponse.RequestID,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	response := TranslationResponse{
-		Request:  commonResponse,
-		Response: isResponse,
-	}
-	json.NewEncoder(w).Encode(response)
-	
-	slog.Info("Common to IS response translation successful",
-		"method", r.Method,
-		"path", r.URL.Path,
-		"remote_addr", r.RemoteAddr,
-		"user_agent", r.UserAgent(),
-		"status", 200,
-		"request_id", commonResponse.RequestID,
-		"user_id", commonResponse.UserID,
-		"duration_ms", time.Since(start).Milliseconds(),
-	)
-}
-
-func isToCommonResponseHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	w.Header().Set("Content-Type", "application/json")
-
-	var isResponse utils.ISResponseFormat
-	if err := json.NewDecoder(r.Body).Decode(&isResponse); err != nil {
+	ctx, err := brandContext(r)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
-		
-		slog.Error("IS to Common response translation failed - invalid JSON",
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error(), Supported: utils.CurrentMappings().BrandNames()})
+
+		slog.Warn("Round trip verification failed - unknown brand",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
 			"status", 400,
-			"error", err.Error(),
+			"kind", kind,
+			"format", format,
+			"brand", r.Header.Get(brandHeader),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	translator := &utils.ISToCommonResponseTranslator{}
-	commonResponse, err := translator.Translate(&isResponse)
+	report, err := registry.VerifyRoundTrip(ctx, kind, format, body)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrUnsupportedPair) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		
-		slog.Error("IS to Common response translation failed - translator error",
+
+		slog.Error("Round trip verification failed - translator error",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 500,
+			"status", status,
+			"kind", kind,
+			"format", format,
 			"error", err.Error(),
-			"request_id", isResponse.ID,
+			"user_id", userID(input),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	response := TranslationResponse{
-		Request:  isResponse,
-		Response: commonResponse,
-	}
-	json.NewEncoder(w).Encode(response)
-	
-	slog.Info("IS to Common response translation successful",
+	json.NewEncoder(w).Encode(report)
+
+	slog.Info("Round trip verification complete",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent(),
 		"status", 200,
-		"request_id", isResponse.ID,
-		"user_id", isResponse.ResolvedUserID,
+		"kind", kind,
+		"format", format,
+		"equal", report.Equal,
+		"differences", len(report.Differences),
+		"user_id", userID(input),
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 }
 
-func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-	slog.SetDefault(logger)
-
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("GET /health", healthHandler)
-	mux.HandleFunc("POST /translate/request/uo-to-common", uoToCommonRequestHandler)
-	mux.HandleFunc("POST /translate/request/common-to-uo", commonToUoRequestHandler)
-	mux.HandleFunc("POST /translate/response/common-to-is", commonToIsResponseHandler)
-	mux.HandleFunc("POST /translate/response/is-to-common", isToCommonResponseHandler)
-	mux.HandleFunc("POST /translate/request/common-to-dy", commonToDyRequestHandler)
-	mux.HandleFunc("POST /translate/request/dy-to-common", dyToCommonRequestHandler)
-
-	slog.Info("Server starting", "port", 8080)
-
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		slog.Error("Server failed to start", "error", err.Error())
-		os.Exit(1)
+// watchMappings reloads the mapping file on SIGHUP and, when interval is positive, whenever
+// its modification time changes. A failed reload keeps the current mappings.
+func watchMappings(interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
-}
-
-func commonToDyRequestHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	w.Header().Set("Content-Type", "application/json")
-
-	var commonRequest utils.CommonRequestFormat
-	if err := json.NewDecoder(r.Body).Decode(&commonRequest); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
 
-		slog.Error("Common to DY request translation failed - invalid JSON",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"remote_addr", r.RemoteAddr,
-			"user_agent", r.UserAgent(),
-			"status", 400,
-			"error", err.Error(),
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-		return
+	for {
+		select {
+		case <-hangup:
+			mappings, err := mappingReloader.Reload()
+			logReload("signal", mappings, err)
+		case <-tick:
+			mappings, reloaded, err := mappingReloader.ReloadIfChanged()
+			if reloaded || err != nil {
+				logReload("watch", mappings, err)
+			}
+		}
 	}
+}
 
-	translator := &utils.CommonToDYRequestTranslator{}
-	dyRequest, err := translator.Translate(&commonRequest)
+func logReload(trigger string, mappings *utils.MappingConfig, err error) {
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-
-		slog.Error("Common to DY request translation failed - translator error",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"remote_addr", r.RemoteAddr,
-			"user_agent", r.UserAgent(),
-			"status", 500,
+		slog.Error("Mappings reload failed - keeping current mappings",
+			"trigger", trigger,
+			"path", mappingReloader.Path(),
+			"revision", utils.CurrentMappings().Revision,
 			"error", err.Error(),
-			"user_id", commonRequest.User.ID,
-			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
+	slog.Info("Mappings reloaded",
+		"trigger", trigger,
+		"path", mappingReloader.Path(),
+		"revision", mappings.Revision,
+	)
+}
 
-	response := TranslationResponse{
-		Request:  commonRequest,
-		Response: dyRequest,
+func mappingsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+
+	response := MappingsResponse{Mappings: utils.CurrentMappings()}
+	if mappingReloader != nil {
+		response.Path = mappingReloader.Path()
 	}
 	json.NewEncoder(w).Encode(response)
 
-	slog.Info("Common to DY request translation successful",
+	slog.Info("Mappings request",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent(),
 		"status", 200,
-		"user_id", commonRequest.User.ID,
-		"event_type", commonRequest.Event.Type,
+		"revision", response.Mappings.Revision,
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 }
 
-func dyToCommonRequestHandler(w http.ResponseWriter, r *http.Request) {
+func reloadMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	swapMappings(w, r, "reload", func() (*utils.MappingConfig, error) {
+		return mappingReloader.Reload()
+	})
+}
+
+func rollbackMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	swapMappings(w, r, "rollback", func() (*utils.MappingConfig, error) {
+		return mappingReloader.Rollback()
+	})
+}
+
+// swapMappings runs a reload or rollback requested through the admin endpoints
+func swapMappings(w http.ResponseWriter, r *http.Request, trigger string, swap func() (*utils.MappingConfig, error)) {
 	start := time.Now()
 	w.Header().Set("Content-Type", "application/json")
 
-	var dyRequest utils.DYChooseRequest
-	if err := json.NewDecoder(r.Body).Decode(&dyRequest); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+	if mappingReloader == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "no mappings file configured"})
 
-		slog.Error("DY to Common request translation failed - invalid JSON",
+		slog.Error("Mappings "+trigger+" failed - no mappings file configured",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 400,
-			"error", err.Error(),
+			"status", 409,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	translator := &utils.DYToCommonRequestTranslator{}
-	commonRequest, err := translator.Translate(&dyRequest)
+	mappings, err := swap()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusUnprocessableEntity)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 
-		slog.Error("DY to Common request translation failed - translator error",
+		slog.Error("Mappings "+trigger+" failed - keeping current mappings",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-			"status", 500,
+			"status", 422,
+			"revision", utils.CurrentMappings().Revision,
 			"error", err.Error(),
-			"user_id", dyRequest.User.Dyid,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 		return
 	}
 
-	response := TranslationResponse{
-		Request:  dyRequest,
-		Response: commonRequest,
+	json.NewEncoder(w).Encode(MappingsResponse{Path: mappingReloader.Path(), Mappings: mappings})
+
+	slog.Info("Mappings "+trigger+" successful",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"status", 200,
+		"revision", mappings.Revision,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
+
+// echoRequest returns the translated request as the response echoes it under echoMode
+func echoRequest(input interface{}) interface{} {
+	switch echoMode {
+	case echoFull:
+		return input
+	case echoRedacted:
+		redacted, err := redactor.Payload(input)
+		if err != nil {
+			// Never fall back to the unredacted request
+			slog.Error("Failed to redact echoed request", "error", err.Error())
+			return nil
+		}
+		return redacted
 	}
-	json.NewEncoder(w).Encode(response)
+	return nil
+}
+
+// configureRedaction sets up the redactor, whose rules override the default rules key
+// by key, and the echo mode
+func configureRedaction(config *Config) {
+	rules := map[string]utils.RedactionMode{}
+	for key, mode := range utils.DefaultRedactionRules {
+		rules[key] = mode
+	}
+	// The rules were validated with the config
+	overrides, _ := utils.ParseRedactionRules(config.RedactionRules)
+	for key, mode := range overrides {
+		rules[key] = mode
+	}
+	redactor = utils.NewRedactor(rules, config.RedactionHashKey)
+	echoMode = config.EchoRequest
+}
+
+// newLogger returns the logger of the configured level and format, redacting attributes
+func newLogger(config *Config) *slog.Logger {
+	level, _ := config.level()
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactor.ReplaceAttr,
+	}
+	if config.LogFormat == "text" {
+		return slog.New(slog.NewTextHandler(os.Stdout, options))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, options))
+}
+
+// limitBody caps the size of request bodies; reading past the limit fails with an
+// *http.MaxBytesError
+func limitBody(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w.Header().Set("Content-Type", "application/json")
 
-	slog.Info("DY to Common request translation successful",
+	json.NewEncoder(w).Encode(ConfigResponse{Settings: config.dump()})
+
+	slog.Info("Config request",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent(),
 		"status", 200,
-		"user_id", dyRequest.User.Dyid,
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 }
+
+// supportedRoutes lists every translation route the registry can serve, e.g. "request/uo-to-dy"
+func supportedRoutes() []string {
+	var routes []string
+	for _, kind := range []utils.Kind{utils.KindRequest, utils.KindResponse} {
+		for _, pair := range registry.Pairs(kind) {
+			routes = append(routes, string(kind)+"/"+pair)
+		}
+	}
+	return routes
+}
+
+// userID returns the user identifier of a payload for logging, if it carries one
+func userID(payload interface{}) string {
+	if identified, ok := payload.(utils.Identified); ok {
+		return identified.UserIdentifier()
+	}
+	return ""
+}
+
+func main() {
+	loaded, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, nil)).Error("Invalid configuration", "error", err.Error())
+		os.Exit(1)
+	}
+	config = loaded
+
+	// Redaction is configured first so that no log line goes out unredacted
+	configureRedaction(config)
+	slog.SetDefault(newLogger(config))
+
+	if path := config.MappingsFile; path != "" {
+		mappingReloader = utils.NewMappingReloader(path)
+		mappings, err := mappingReloader.Reload()
+		if err != nil {
+			slog.Error("Failed to load mappings", "path", path, "error", err.Error())
+			os.Exit(1)
+		}
+		slog.Info("Mappings loaded", "path", path, "revision", mappings.Revision)
+		go watchMappings(config.MappingsWatchInterval)
+	}
+
+	// Carry derived sessions across requests by visitor inactivity
+	if config.SessionTracking {
+		utils.SetSessionTracker(utils.NewSessionTracker(utils.SessionInactivityTimeout))
+	}
+
+	// Link user IDs across formats when an identity store is configured
+	switch config.IdentityStore {
+	case identityStoreFile:
+		store, err := utils.NewFileIdentityStore(config.IdentityStoreFile, config.IdentityStoreLimit)
+		if err != nil {
+			slog.Error("Failed to load identity store", "path", config.IdentityStoreFile, "error", err.Error())
+			os.Exit(1)
+		}
+		utils.SetIdentityStore(store)
+		slog.Info("Identity store loaded", "path", config.IdentityStoreFile)
+	case identityStoreMemory:
+		utils.SetIdentityStore(utils.NewMemoryIdentityStore(config.IdentityStoreLimit))
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /health", healthHandler)
+	mux.HandleFunc("POST /translate/{kind}/{pair}", translateHandler)
+	mux.HandleFunc("POST /translate/{kind}/{from}/{to}", translateHandler)
+	mux.HandleFunc("POST /verify/roundtrip/{format}", verifyRoundTripHandler)
+	if config.AdminEndpoints {
+		mux.HandleFunc("GET /admin/mappings", mappingsHandler)
+		mux.HandleFunc("POST /admin/mappings/reload", reloadMappingsHandler)
+		mux.HandleFunc("POST /admin/mappings/rollback", rollbackMappingsHandler)
+		mux.HandleFunc("GET /config", configHandler)
+	}
+
+	server := &http.Server{
+		Addr:         config.Addr,
+		Handler:      limitBody(mux, config.MaxBodyBytes),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+
+	slog.Info("Server starting", "addr", config.Addr, "echo_request", echoMode)
+
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Server failed to start", "error", err.Error())
+		os.Exit(1)
+	}
+}
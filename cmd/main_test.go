@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranslateUnsupportedPairListsSupportedRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /translate/{kind}/{pair}", translateHandler)
+	mux.HandleFunc("POST /translate/{kind}/{from}/{to}", translateHandler)
+
+	for _, path := range []string{"/translate/request/uo/xml", "/translate/request/uo-to-xml"} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, recorder.Code)
+		}
+		var response ErrorResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Error == "" {
+			t.Errorf("%s: no error message", path)
+		}
+		supported := strings.Join(response.Supported, ",")
+		for _, route := range []string{"request/uo-to-dy", "request/dy-to-common", "response/is-to-dy"} {
+			if !strings.Contains(supported, route) {
+				t.Errorf("%s: supported routes %v lack %s", path, response.Supported, route)
+			}
+		}
+		if len(response.Supported) != len(supportedRoutes()) {
+			t.Errorf("%s: %d supported routes, want %d", path, len(response.Supported), len(supportedRoutes()))
+		}
+	}
+}
@@ -2,6 +2,8 @@ module personalization-content-converter
 
 go 1.24.5
 
+require gopkg.in/yaml.v3 v3.0.1
+
 require (
 	cel.dev/expr v0.24.0 // indirect
 	cloud.google.com/go v0.121.4 // indirect
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RequestDefaults - Values the request translators fill in when a source format does not carry them
+type RequestDefaults struct {
+	Locale      string `json:"locale,omitempty" yaml:"locale,omitempty"`
+	Language    string `json:"language,omitempty" yaml:"language,omitempty"`
+	Channel     string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	CountryCode string `json:"countryCode,omitempty" yaml:"countryCode,omitempty"`
+	// Currency applies when the locale has no region with a known currency
+	Currency string `json:"currency,omitempty" yaml:"currency,omitempty"`
+}
+
+// BrandProfile - Brand-specific defaults and mapping entries. A request is matched to a
+// brand by its URL host or a product ID prefix, or named explicitly by the caller.
+// Defaults and table entries set here override the base mapping config; anything left
+// empty is inherited.
+type BrandProfile struct {
+	Hosts             []string        `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	ProductIDPrefixes []string        `json:"productIdPrefixes,omitempty" yaml:"productIdPrefixes,omitempty"`
+	Defaults          RequestDefaults `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+	UO                UOMappings      `json:"uo,omitempty" yaml:"uo,omitempty"`
+	DY                DYMappings      `json:"dy,omitempty" yaml:"dy,omitempty"`
+}
+
+type brandContextKey struct{}
+
+// WithBrand returns a context that selects the named brand profile for translations,
+// overriding detection from the payload
+func WithBrand(ctx context.Context, brand string) context.Context {
+	return context.WithValue(ctx, brandContextKey{}, brand)
+}
+
+// BrandFromContext returns the brand selected with WithBrand, if any
+func BrandFromContext(ctx context.Context) string {
+	brand, _ := ctx.Value(brandContextKey{}).(string)
+	return brand
+}
+
+// brandHinted is implemented by payloads that carry URLs or product IDs a brand can be
+// detected from
+type brandHinted interface {
+	brandHints() (brand string, urls []string, productIDs []string)
+}
+
+func (r *CommonRequestFormat) brandHints() (string, []string, []string) {
+	productIDs := make([]string, len(r.Products))
+	for i, product := range r.Products {
+		productIDs[i] = product.ID
+	}
+	return r.Brand, []string{r.Page.URL}, productIDs
+}
+
+func (r *UOCurrentRequestFormat) brandHints() (string, []string, []string) {
+	var productIDs []string
+	if product := r.IsEvent.Catalog.Item(); product != nil {
+		productIDs = append(productIDs, product.ID)
+	}
+	for _, item := range r.IsEvent.Cart.Items() {
+		productIDs = append(productIDs, item.ID)
+	}
+	if r.IsEvent.Order != nil && r.IsEvent.Order.Product != nil {
+		for _, item := range r.IsEvent.Order.Product.LineItems {
+			productIDs = append(productIDs, item.ID)
+		}
+	}
+	return "", []string{r.IsEvent.Source.URL}, productIDs
+}
+
+func (r *DYChooseRequest) brandHints() (string, []string, []string) {
+	return "", []string{r.Context.Page.Location}, r.Context.Page.Data
+}
+
+// BrandNames returns the configured brand names in sorted order
+func (m *MappingConfig) BrandNames() []string {
+	names := make([]string, 0, len(m.Brands))
+	for name := range m.Brands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectBrand returns the first brand whose hosts match one of the URLs, else the first
+// whose product ID prefixes match one of the product IDs, else ""
+func (m *MappingConfig) DetectBrand(urls, productIDs []string) string {
+	names := m.BrandNames()
+
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+		for _, name := range names {
+			for _, brandHost := range m.Brands[name].Hosts {
+				brandHost = strings.ToLower(brandHost)
+				if host == brandHost || strings.HasSuffix(host, "."+brandHost) {
+					return name
+				}
+			}
+		}
+	}
+
+	for _, productID := range productIDs {
+		for _, name := range names {
+			for _, prefix := range m.Brands[name].ProductIDPrefixes {
+				if strings.HasPrefix(productID, prefix) {
+					return name
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// ForBrand returns the mapping config with the named brand profile applied. The empty
+// brand returns m unchanged.
+func (m *MappingConfig) ForBrand(brand string) (*MappingConfig, error) {
+	if brand == "" {
+		return m, nil
+	}
+	profile, exists := m.Brands[brand]
+	if !exists {
+		return nil, fmt.Errorf("unknown brand %q", brand)
+	}
+
+	resolved := &MappingConfig{
+		Version:  m.Version,
+		Revision: m.Revision,
+		Brand:    brand,
+		Defaults: mergeDefaults(m.Defaults, profile.Defaults),
+		UO: UOMappings{
+			ActionToEventType:     mergeTable(m.UO.ActionToEventType, profile.UO.ActionToEventType),
+			DefaultEventType:      mergeDefault(m.UO.DefaultEventType, profile.UO.DefaultEventType),
+			PageTypeToCommon:      mergeTable(m.UO.PageTypeToCommon, profile.UO.PageTypeToCommon),
+			DefaultCommonPageType: mergeDefault(m.UO.DefaultCommonPageType, profile.UO.DefaultCommonPageType),
+			CommonPageTypeToUO:    mergeTable(m.UO.CommonPageTypeToUO, profile.UO.CommonPageTypeToUO),
+			DefaultPageType:       mergeDefault(m.UO.DefaultPageType, profile.UO.DefaultPageType),
+			EventTypeToAction:     mergeTable(m.UO.EventTypeToAction, profile.UO.EventTypeToAction),
+			DefaultAction:         mergeDefault(m.UO.DefaultAction, profile.UO.DefaultAction),
+			EventTypeToItemAction: mergeTable(m.UO.EventTypeToItemAction, profile.UO.EventTypeToItemAction),
+			DefaultItemAction:     mergeDefault(m.UO.DefaultItemAction, profile.UO.DefaultItemAction),
+		},
+		DY: DYMappings{
+			CommonPageTypeToDY:    mergeTable(m.DY.CommonPageTypeToDY, profile.DY.CommonPageTypeToDY),
+			DefaultPageType:       mergeDefault(m.DY.DefaultPageType, profile.DY.DefaultPageType),
+			PageTypeToCommon:      mergeTable(m.DY.PageTypeToCommon, profile.DY.PageTypeToCommon),
+			DefaultCommonPageType: mergeDefault(m.DY.DefaultCommonPageType, profile.DY.DefaultCommonPageType),
+			PageTypeToEventType:   mergeTable(m.DY.PageTypeToEventType, profile.DY.PageTypeToEventType),
+			DefaultEventType:      mergeDefault(m.DY.DefaultEventType, profile.DY.DefaultEventType),
+			SelectorPlacements:    mergeTable(m.DY.SelectorPlacements, profile.DY.SelectorPlacements),
+		},
+	}
+	return resolved, nil
+}
+
+// mappingsFor resolves the current mapping config for a translation: the brand named in
+// ctx, else the brand detected from the payload, else the base config
+func mappingsFor(ctx context.Context, payload interface{}) (*MappingConfig, error) {
+	mappings := CurrentMappings()
+
+	brand := BrandFromContext(ctx)
+	if hinted, ok := payload.(brandHinted); ok && brand == "" {
+		var urls, productIDs []string
+		brand, urls, productIDs = hinted.brandHints()
+		if _, exists := mappings.Brands[brand]; !exists {
+			brand = mappings.DetectBrand(urls, productIDs)
+		}
+	}
+
+	return mappings.ForBrand(brand)
+}
+
+func mergeDefaults(base, override RequestDefaults) RequestDefaults {
+	return RequestDefaults{
+		Locale:      mergeDefault(base.Locale, override.Locale),
+		Language:    mergeDefault(base.Language, override.Language),
+		Channel:     mergeDefault(base.Channel, override.Channel),
+		CountryCode: mergeDefault(base.CountryCode, override.CountryCode),
+		Currency:    mergeDefault(base.Currency, override.Currency),
+	}
+}
+
+func mergeDefault(base, override string) string {
+	if override != "" {
+		return override
+	}
+	return base
+}
+
+func mergeTable[V any](base, override map[string]V) map[string]V {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]V, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
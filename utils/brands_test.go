@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDetectBrand(t *testing.T) {
+	mappings := DefaultMappings()
+
+	for _, tc := range []struct {
+		urls       []string
+		productIDs []string
+		want       string
+	}{
+		{[]string{"https://www.anthropologie.com/wedding"}, nil, "anthropologie"},
+		{[]string{"https://shopterrain.com/"}, []string{"AN-100807742-000-070"}, "terrain"},
+		{[]string{"/shop/carpe-diem-shorts"}, []string{"FP-97519623-000"}, "free-people"},
+		{[]string{"https://www.urbn.com/"}, []string{"ANT-4130249-095"}, "anthropologie"},
+		{[]string{"https://www.urbn.com/"}, []string{"12345"}, ""},
+	} {
+		if got := mappings.DetectBrand(tc.urls, tc.productIDs); got != tc.want {
+			t.Errorf("DetectBrand(%v, %v) = %q, want %q", tc.urls, tc.productIDs, got, tc.want)
+		}
+	}
+}
+
+func TestBrandProfileOverridesDefaults(t *testing.T) {
+	mappings := DefaultMappings()
+	mappings.Brands["urban-outfitters-uk"] = BrandProfile{
+		Hosts:    []string{"urbanoutfitters.co.uk"},
+		Defaults: RequestDefaults{Locale: "en_GB", CountryCode: "GB"},
+	}
+	if err := mappings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	previous := CurrentMappings()
+	activeMappings.Store(mappings)
+	t.Cleanup(func() { activeMappings.Store(previous) })
+
+	common := &CommonRequestFormat{Page: PageContext{Type: "homepage", URL: "https://www.urbanoutfitters.co.uk/"}}
+	translator, err := NewDefaultRegistry().Lookup(KindRequest, FormatCommon, FormatUO)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := translator.Translate(context.Background(), common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isEvent := output.(*UOCurrentRequestFormat).IsEvent
+	if isEvent.Source.Locale != "en_GB" || isEvent.User.Attributes.CountryCode != "GB" || isEvent.Source.Channel != "Server" {
+		t.Errorf("brand defaults not applied: locale=%q country=%q channel=%q",
+			isEvent.Source.Locale, isEvent.User.Attributes.CountryCode, isEvent.Source.Channel)
+	}
+
+	// A brand named by the caller wins over detection
+	output, err = translator.Translate(WithBrand(context.Background(), "anthropologie"), common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := output.(*UOCurrentRequestFormat).IsEvent.Source.Locale; got != "en_US" {
+		t.Errorf("locale = %q, want en_US", got)
+	}
+
+	if _, err := translator.Translate(WithBrand(context.Background(), "unknown"), common); err == nil {
+		t.Error("expected an unknown brand to be rejected")
+	}
+}
+
+func TestValidateChecksBrandTables(t *testing.T) {
+	mappings := DefaultMappings()
+	mappings.Brands["terrain"] = BrandProfile{
+		UO: UOMappings{ActionToEventType: map[string]string{"HomepageView": "homepage_view"}},
+	}
+
+	err := mappings.Validate()
+	if err == nil || !strings.Contains(err.Error(), `brands.terrain.uo.actionToEventType produces "homepage_view"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
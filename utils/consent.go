@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ConsentContext - Whether the user consented to tracking, and the fields the consent
+// policy suppressed for lack of it
+type ConsentContext struct {
+	Granted    bool     `json:"granted"`
+	Suppressed []string `json:"suppressed,omitempty"`
+}
+
+// User attributes carrying identifiers that are dropped without consent
+var consentSuppressedAttributes = []string{dyHashedEmailAttribute, dyCUIDAttribute, dyCUIDTypeAttribute}
+
+// hashedIdentifierPrefix marks identifiers the consent policy replaced by their hash
+const hashedIdentifierPrefix = "sha256:"
+
+// enforceConsent applies the consent policy to a common request. Without consent, email
+// addresses, IP addresses, user agents and identifying user attributes are dropped and
+// customer IDs replaced by their hash, in the common sections and the UO extensions
+// alike; the consent section records what was suppressed. The request is not modified:
+// a scrubbed copy is returned. Requests with consent, or no consent section, are
+// returned as they are.
+func enforceConsent(commonRequest *CommonRequestFormat) *CommonRequestFormat {
+	if commonRequest.Consent == nil || commonRequest.Consent.Granted {
+		return commonRequest
+	}
+
+	scrubbed := *commonRequest
+	consent := *commonRequest.Consent
+	consent.Suppressed = append([]string(nil), consent.Suppressed...)
+	suppress := func(path string) {
+		for _, suppressed := range consent.Suppressed {
+			if suppressed == path {
+				return
+			}
+		}
+		consent.Suppressed = append(consent.Suppressed, path)
+	}
+
+	if scrubbed.User.Email != "" {
+		scrubbed.User.Email = ""
+		suppress("user.email")
+	}
+	copied := false
+	for _, name := range consentSuppressedAttributes {
+		if _, exists := commonRequest.User.Attributes[name]; !exists {
+			continue
+		}
+		if !copied {
+			scrubbed.User.Attributes = copyAttributes(commonRequest.User.Attributes)
+			copied = true
+		}
+		delete(scrubbed.User.Attributes, name)
+		suppress("user.attributes." + name)
+	}
+
+	if scrubbed.Device.IP != "" {
+		scrubbed.Device.IP = ""
+		suppress("device.ip")
+	}
+	if scrubbed.Device.UserAgent != "" {
+		scrubbed.Device.UserAgent = ""
+		suppress("device.userAgent")
+	}
+
+	if identity := scrubbed.Identity; identity != nil {
+		identifiers := append([]Identifier(nil), identity.Identifiers...)
+		for i, identifier := range identifiers {
+			if identifier.Type == IdentifierCustomer && !strings.HasPrefix(identifier.Value, hashedIdentifierPrefix) {
+				identifiers[i].Value = hashIdentifier(identifier.Value)
+				suppress("identity." + identifier.Namespace)
+			}
+		}
+		scrubbed.Identity = &IdentityContext{Identifiers: identifiers}
+	}
+
+	if scrubbed.Extensions != nil && scrubbed.Extensions.UO != nil {
+		extensions := *scrubbed.Extensions
+		uo := *extensions.UO
+		uo.UserAttributes.Email = ""
+		if uo.UserAttributes.CustomerID != "" && !strings.HasPrefix(uo.UserAttributes.CustomerID, hashedIdentifierPrefix) {
+			uo.UserAttributes.CustomerID = hashIdentifier(uo.UserAttributes.CustomerID)
+		}
+		if uo.Device != nil {
+			device := *uo.Device
+			device.IP = ""
+			device.UserAgent = ""
+			uo.Device = &device
+		}
+		extensions.UO = &uo
+		scrubbed.Extensions = &extensions
+	}
+
+	scrubbed.Consent = &consent
+	return &scrubbed
+}
+
+// hashIdentifier returns the prefixed hex SHA-256 of an identifier
+func hashIdentifier(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hashedIdentifierPrefix + hex.EncodeToString(sum[:])
+}
+
+func copyAttributes(attributes map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		copied[name] = value
+	}
+	return copied
+}
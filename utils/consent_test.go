@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConsentSuppressesIdentifiers(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			User: IsEventUser{
+				ID: "visitor-1",
+				Attributes: IsEventUserAttributes{
+					CustomerID:         "cust-42",
+					CustomerNonConsent: true,
+					Email:              "shopper@example.com",
+				},
+			},
+			Device: &IsEventDevice{
+				UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 Safari/604.1",
+				IP:        "203.0.113.7",
+			},
+			Timestamp: "2024-05-01T12:00:00Z",
+		},
+	}
+
+	commonRequest, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commonRequest.User.Email != "" || commonRequest.Device.IP != "" || commonRequest.Device.UserAgent != "" {
+		t.Errorf("identifiers kept without consent: email %q, ip %q, user agent %q",
+			commonRequest.User.Email, commonRequest.Device.IP, commonRequest.Device.UserAgent)
+	}
+	if commonRequest.Device.Type != DeviceTypeMobile {
+		t.Errorf("device type = %q, want the classification to survive suppression", commonRequest.Device.Type)
+	}
+	if customer := commonRequest.Identity.Value(NamespaceCustomer); customer != hashIdentifier("cust-42") {
+		t.Errorf("customer identifier = %q, want its hash", customer)
+	}
+	want := &ConsentContext{
+		Granted:    false,
+		Suppressed: []string{"user.email", "device.ip", "device.userAgent", "identity.customer"},
+	}
+	if !reflect.DeepEqual(commonRequest.Consent, want) {
+		t.Errorf("consent = %+v, want %+v", commonRequest.Consent, want)
+	}
+
+	// Neither target format may carry the identifiers back out, and both flag the
+	// missing consent
+	uoOut, err := (&CommonToUOTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := uoOut.IsEvent.User.Attributes
+	if attributes.Email != "" || attributes.CustomerID != hashIdentifier("cust-42") || !attributes.CustomerNonConsent {
+		t.Errorf("UO user attributes = %+v", attributes)
+	}
+	if device := uoOut.IsEvent.Device; device != nil && (device.IP != "" || device.UserAgent != "") {
+		t.Errorf("UO device = %+v", device)
+	}
+
+	dyOut, err := (&CommonToDYRequestTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dyOut.User.ActiveConsentAccepted {
+		t.Error("DY active_consent_accepted = true without consent")
+	}
+	if dyOut.Context.Device.Ip != "" || dyOut.Context.Device.UserAgent != "" {
+		t.Errorf("DY device = %+v", dyOut.Context.Device)
+	}
+}
+
+func TestEnforceConsentLeavesInputUntouched(t *testing.T) {
+	commonRequest := &CommonRequestFormat{
+		User: UserContext{
+			Email: "shopper@example.com",
+			Attributes: map[string]interface{}{
+				dyHashedEmailAttribute: "abc123",
+				dyCUIDAttribute:        "cust-42",
+				"locale":               "en_US",
+			},
+		},
+		Consent: &ConsentContext{Granted: false},
+	}
+
+	scrubbed := enforceConsent(commonRequest)
+	if commonRequest.User.Email == "" || len(commonRequest.User.Attributes) != 3 || commonRequest.Consent.Suppressed != nil {
+		t.Errorf("input modified: %+v", commonRequest)
+	}
+	if _, exists := scrubbed.User.Attributes[dyCUIDAttribute]; exists || scrubbed.User.Attributes["locale"] != "en_US" {
+		t.Errorf("scrubbed attributes = %v", scrubbed.User.Attributes)
+	}
+
+	// Enforcing again suppresses nothing further
+	again := enforceConsent(scrubbed)
+	if !reflect.DeepEqual(again, scrubbed) {
+		t.Errorf("second pass changed the request: %+v", again.Consent)
+	}
+	if got := strings.Join(again.Consent.Suppressed, ","); got != "user.email,user.attributes.hashed_email,user.attributes.cuid" {
+		t.Errorf("suppressed = %s", got)
+	}
+
+	granted := &CommonRequestFormat{User: UserContext{Email: "shopper@example.com"}, Consent: &ConsentContext{Granted: true}}
+	if enforceConsent(granted) != granted {
+		t.Error("request with consent was copied")
+	}
+}
+
+func TestConsentKeepsIdentifiersOutOfTheIdentityStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.jsonl")
+	store, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	SetIdentityStore(store)
+	t.Cleanup(func() { SetIdentityStore(nil) })
+
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			User: IsEventUser{
+				ID:         "visitor-1",
+				Attributes: IsEventUserAttributes{CustomerID: "cust-42", CustomerNonConsent: true},
+			},
+		},
+	}
+	if _, err := (&UOToCommonTranslator{}).Translate(uoRequest); err != nil {
+		t.Fatal(err)
+	}
+	dyRequest := &DYEventRequest{
+		User: DYUser{Dyid: "dy-1", ActiveConsentAccepted: false},
+		Events: []DYEvent{{Name: "Login", Properties: DYEventProperties{
+			DYType: DYEventTypeLogin, CUID: "cust-42", CUIDType: dyCUIDTypeCustomerID,
+		}}},
+	}
+	if _, err := (&DYEventToCommonTranslator{}).Translate(dyRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"cust-42", "visitor-1", "dy-1"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("identity store file holds %s without consent: %s", leaked, data)
+		}
+	}
+}
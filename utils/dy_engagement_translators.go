@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DY engagement types of the engagement reporting API
+const (
+	DYEngagementClick      = "CLICK"
+	DYEngagementImpression = "IMP"
+	DYEngagementSlotClick  = "SLOT_CLICK"
+	DYEngagementSlotImp    = "SLOT_IMP"
+)
+
+// Common engagement types
+const (
+	EngagementClick      = "click"
+	EngagementImpression = "impression"
+)
+
+// EngagementContext - A reported interaction with a served decision. Slot engagements
+// concern a single recommendation slot rather than the whole variation.
+type EngagementContext struct {
+	Type         string  `json:"type"`
+	DecisionID   string  `json:"decisionId,omitempty"`
+	VariationIDs []int64 `json:"variationIds,omitempty"`
+	SlotID       string  `json:"slotId,omitempty"`
+}
+
+// DYEngagementRequest represents the request payload for the Dynamic Yield engagement
+// reporting API
+type DYEngagementRequest struct {
+	User        DYUser         `json:"user"`
+	Session     DYSession      `json:"session"`
+	Context     *DYContext     `json:"context,omitempty"`
+	Engagements []DYEngagement `json:"engagements"`
+}
+
+// DYEngagement represents a single reported engagement
+type DYEngagement struct {
+	Type       string  `json:"type"`
+	DecisionID string  `json:"decisionId,omitempty"`
+	Variations []int64 `json:"variations,omitempty"`
+	SlotID     string  `json:"slotId,omitempty"`
+}
+
+// CommonToDYEngagementTranslator translates common requests carrying engagements into DY
+// engagement reporting requests
+type CommonToDYEngagementTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+// Translate performs the translation
+func (t *CommonToDYEngagementTranslator) Translate(commonRequest *CommonRequestFormat) (*DYEngagementRequest, error) {
+	if len(commonRequest.Engagements) == 0 {
+		return nil, errors.New("request carries no engagements")
+	}
+
+	// Suppress identifiers the user did not consent to share
+	commonRequest = enforceConsent(commonRequest)
+
+	requestTranslator := &CommonToDYRequestTranslator{Mappings: t.Mappings}
+	dyRequest := &DYEngagementRequest{
+		User: requestTranslator.buildUser(commonRequest),
+		Session: DYSession{
+			Dy: commonRequest.Session.ID,
+		},
+	}
+
+	// Context is optional for engagements; send it only when the page is known
+	if commonRequest.Page.URL != "" {
+		context := requestTranslator.buildContext(commonRequest)
+		dyRequest.Context = &context
+	}
+
+	for i, engagement := range commonRequest.Engagements {
+		dyType, err := dyEngagementType(&engagement)
+		if err != nil {
+			return nil, fmt.Errorf("engagement %d: %w", i, err)
+		}
+		dyRequest.Engagements = append(dyRequest.Engagements, DYEngagement{
+			Type:       dyType,
+			DecisionID: engagement.DecisionID,
+			Variations: engagement.VariationIDs,
+			SlotID:     engagement.SlotID,
+		})
+	}
+
+	return dyRequest, nil
+}
+
+func dyEngagementType(engagement *EngagementContext) (string, error) {
+	slot := engagement.SlotID != ""
+	switch {
+	case engagement.Type == EngagementClick && slot:
+		return DYEngagementSlotClick, nil
+	case engagement.Type == EngagementClick:
+		return DYEngagementClick, nil
+	case engagement.Type == EngagementImpression && slot:
+		return DYEngagementSlotImp, nil
+	case engagement.Type == EngagementImpression:
+		return DYEngagementImpression, nil
+	default:
+		return "", fmt.Errorf("unsupported engagement type %q", engagement.Type)
+	}
+}
+
+// DYEngagementToCommonTranslator translates DY engagement reporting requests into the
+// common format, as an "engagement" event
+type DYEngagementToCommonTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+// Translate performs the translation
+func (t *DYEngagementToCommonTranslator) Translate(dyRequest *DYEngagementRequest) (*CommonRequestFormat, error) {
+	requestTranslator := &DYToCommonRequestTranslator{Mappings: t.Mappings}
+	commonRequest := &CommonRequestFormat{
+		Personalized: true,
+		Brand:        requestTranslator.config().Brand,
+		User:         requestTranslator.extractUser(&dyRequest.User),
+		Identity:     requestTranslator.extractIdentity(&dyRequest.User, ""),
+		Session: SessionContext{
+			ID: dyRequest.Session.Dy,
+		},
+		Event: EventContext{
+			Type:   "engagement",
+			Source: dyEventSource,
+		},
+		Consent:   &ConsentContext{Granted: dyRequest.User.ActiveConsentAccepted},
+		Timestamp: now().UTC().Format(time.RFC3339),
+	}
+
+	if dyRequest.Context != nil {
+		commonRequest.Page = requestTranslator.extractPage(&dyRequest.Context.Page)
+		commonRequest.Products = requestTranslator.extractProducts(&dyRequest.Context.Page)
+		commonRequest.Device = requestTranslator.extractDevice(&dyRequest.Context.Device)
+		commonRequest.Geo = extractDYGeo(dyRequest.Context.PageAttributes)
+	}
+
+	for i, dyEngagement := range dyRequest.Engagements {
+		engagement := EngagementContext{
+			DecisionID:   dyEngagement.DecisionID,
+			VariationIDs: dyEngagement.Variations,
+			SlotID:       dyEngagement.SlotID,
+		}
+		switch strings.TrimPrefix(dyEngagement.Type, "SLOT_") {
+		case DYEngagementClick:
+			engagement.Type = EngagementClick
+		case DYEngagementImpression:
+			engagement.Type = EngagementImpression
+		default:
+			return nil, fmt.Errorf("engagement %d: unsupported DY engagement type %q", i, dyEngagement.Type)
+		}
+		commonRequest.Engagements = append(commonRequest.Engagements, engagement)
+	}
+
+	// Suppress identifiers the user did not consent to share
+	return enforceConsent(commonRequest), nil
+}
+
+// UserIdentifier returns the DY user ID
+func (r *DYEngagementRequest) UserIdentifier() string {
+	return r.User.Dyid
+}
+
+func (r *DYEngagementRequest) brandHints() (string, []string, []string) {
+	if r.Context == nil {
+		return "", nil, nil
+	}
+	return "", []string{r.Context.Page.Location}, r.Context.Page.Data
+}
@@ -0,0 +1,412 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DY event types (properties.dyType) of the event reporting API
+const (
+	DYEventTypePurchase  = "purchase-v1"
+	DYEventTypeAddToCart = "add-to-cart-v1"
+	DYEventTypeLogin     = "login-v1"
+	DYEventTypeSignup    = "signup-v1"
+	DYEventTypeSearch    = "keyword-search-v1"
+)
+
+// Default DY event names per dyType, used when the common event carries no action
+var dyEventNames = map[string]string{
+	DYEventTypePurchase:  "Purchase",
+	DYEventTypeAddToCart: "Add to Cart",
+	DYEventTypeLogin:     "Login",
+	DYEventTypeSignup:    "Signup",
+	DYEventTypeSearch:    "Keyword Search",
+}
+
+// Common event types with a DY event of their own, besides purchases
+var commonEventTypeToDY = map[string]string{
+	"add_to_cart": DYEventTypeAddToCart,
+	"login":       DYEventTypeLogin,
+	"signup":      DYEventTypeSignup,
+	"search":      DYEventTypeSearch,
+}
+
+// User attributes that carry DY identify event properties through the common format
+const (
+	dyHashedEmailAttribute = "hashed_email"
+	dyCUIDAttribute        = "cuid"
+	dyCUIDTypeAttribute    = "cuid_type"
+)
+
+// DYEventRequest represents the request payload for the Dynamic Yield event reporting API
+type DYEventRequest struct {
+	User    DYUser    `json:"user"`
+	Session DYSession `json:"session"`
+	Context DYContext `json:"context"`
+	Events  []DYEvent `json:"events"`
+}
+
+// DYEvent represents a single reported event
+type DYEvent struct {
+	Name       string            `json:"name"`
+	Properties DYEventProperties `json:"properties"`
+}
+
+// DYEventProperties represents the properties of a DY event; dyType selects which apply
+type DYEventProperties struct {
+	DYType              string       `json:"dyType"`
+	Value               float64      `json:"value,omitempty"`
+	Currency            string       `json:"currency,omitempty"`
+	UniqueTransactionID string       `json:"uniqueTransactionId,omitempty"`
+	ProductID           string       `json:"productId,omitempty"`
+	Quantity            int          `json:"quantity,omitempty"`
+	Cart                []DYCartItem `json:"cart,omitempty"`
+	HashedEmail         string       `json:"hashedEmail,omitempty"`
+	CUID                string       `json:"cuid,omitempty"`
+	CUIDType            string       `json:"cuidType,omitempty"`
+	Keywords            string       `json:"keywords,omitempty"`
+}
+
+// DYCartItem represents a cart line of a DY purchase event
+type DYCartItem struct {
+	ProductID string  `json:"productId"`
+	Quantity  int     `json:"quantity"`
+	ItemPrice float64 `json:"itemPrice"`
+}
+
+// CommonToDYEventTranslator translates common requests that carry an event DY can record
+// into DY event reporting requests
+type CommonToDYEventTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+// Translate performs the translation
+func (t *CommonToDYEventTranslator) Translate(commonRequest *CommonRequestFormat) (*DYEventRequest, error) {
+	// Suppress identifiers the user did not consent to share
+	commonRequest = enforceConsent(commonRequest)
+
+	event, err := t.buildEvent(commonRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	requestTranslator := &CommonToDYRequestTranslator{Mappings: t.Mappings}
+	dyRequest := &DYEventRequest{
+		User: requestTranslator.buildUser(commonRequest),
+		Session: DYSession{
+			Dy: commonRequest.Session.ID,
+		},
+		Context: requestTranslator.buildContext(commonRequest),
+		Events:  []DYEvent{event},
+	}
+
+	return dyRequest, nil
+}
+
+func (t *CommonToDYEventTranslator) buildEvent(commonRequest *CommonRequestFormat) (DYEvent, error) {
+	switch {
+	case commonRequest.Order != nil:
+		return t.buildPurchaseEvent(commonRequest), nil
+	case commonRequest.Event.Type == "purchase":
+		return DYEvent{}, errors.New("purchase event carries no order")
+	case commonEventTypeToDY[commonRequest.Event.Type] == DYEventTypeAddToCart:
+		return t.buildAddToCartEvent(commonRequest)
+	case commonEventTypeToDY[commonRequest.Event.Type] == DYEventTypeSearch:
+		return t.buildSearchEvent(commonRequest)
+	case commonEventTypeToDY[commonRequest.Event.Type] != "":
+		return t.buildIdentifyEvent(commonRequest, commonEventTypeToDY[commonRequest.Event.Type]), nil
+	default:
+		return DYEvent{}, fmt.Errorf("event type %q has no DY event", commonRequest.Event.Type)
+	}
+}
+
+// buildPurchaseEvent reports the order with its purchased products as the cart. DY
+// purchase events carry no discounts; the value is the order revenue after them.
+func (t *CommonToDYEventTranslator) buildPurchaseEvent(commonRequest *CommonRequestFormat) DYEvent {
+	order := commonRequest.Order
+
+	properties := DYEventProperties{
+		DYType:              DYEventTypePurchase,
+		Value:               order.Revenue,
+		Currency:            t.currency(commonRequest, order.Currency),
+		UniqueTransactionID: order.ID,
+	}
+	for _, product := range productsWithRole(commonRequest.Products, ProductRolePurchased) {
+		properties.Cart = append(properties.Cart, DYCartItem{
+			ProductID: product.ID,
+			Quantity:  product.Quantity,
+			ItemPrice: product.Price,
+		})
+	}
+
+	return DYEvent{
+		Name:       t.eventName(commonRequest, DYEventTypePurchase),
+		Properties: properties,
+	}
+}
+
+// buildAddToCartEvent reports the viewed product as the one added, and the in-cart
+// products as the resulting cart
+func (t *CommonToDYEventTranslator) buildAddToCartEvent(commonRequest *CommonRequestFormat) (DYEvent, error) {
+	viewed := productsWithRole(commonRequest.Products, ProductRoleViewed)
+	if len(viewed) == 0 {
+		return DYEvent{}, errors.New("add to cart event carries no product")
+	}
+	product := viewed[0]
+
+	quantity := product.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+
+	properties := DYEventProperties{
+		DYType:    DYEventTypeAddToCart,
+		Value:     product.Price * float64(quantity),
+		Currency:  t.currency(commonRequest, product.Currency),
+		ProductID: product.ID,
+		Quantity:  quantity,
+	}
+	for _, cartProduct := range productsWithRole(commonRequest.Products, ProductRoleInCart) {
+		properties.Cart = append(properties.Cart, DYCartItem{
+			ProductID: cartProduct.ID,
+			Quantity:  cartProduct.Quantity,
+			ItemPrice: cartProduct.Price,
+		})
+	}
+
+	return DYEvent{
+		Name:       t.eventName(commonRequest, DYEventTypeAddToCart),
+		Properties: properties,
+	}, nil
+}
+
+// buildSearchEvent reports the search query as the keywords
+func (t *CommonToDYEventTranslator) buildSearchEvent(commonRequest *CommonRequestFormat) (DYEvent, error) {
+	if commonRequest.Search == nil || commonRequest.Search.Query == "" {
+		return DYEvent{}, errors.New("search event carries no query")
+	}
+
+	return DYEvent{
+		Name: t.eventName(commonRequest, DYEventTypeSearch),
+		Properties: DYEventProperties{
+			DYType:   DYEventTypeSearch,
+			Keywords: commonRequest.Search.Query,
+		},
+	}, nil
+}
+
+// buildIdentifyEvent reports a login or signup. DY takes a SHA-256 hash of the email,
+// never the email itself.
+func (t *CommonToDYEventTranslator) buildIdentifyEvent(commonRequest *CommonRequestFormat, dyType string) DYEvent {
+	user := &commonRequest.User
+
+	properties := DYEventProperties{DYType: dyType}
+	if user.Email != "" {
+		properties.HashedEmail = hashEmail(user.Email)
+	} else if hashed, ok := user.Attributes[dyHashedEmailAttribute].(string); ok {
+		properties.HashedEmail = hashed
+	}
+	if cuid, ok := user.Attributes[dyCUIDAttribute].(string); ok {
+		properties.CUID = cuid
+	}
+	if cuidType, ok := user.Attributes[dyCUIDTypeAttribute].(string); ok {
+		properties.CUIDType = cuidType
+	}
+
+	return DYEvent{
+		Name:       t.eventName(commonRequest, dyType),
+		Properties: properties,
+	}
+}
+
+// hashEmail returns the hex SHA-256 of the normalized email, as DY expects
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// currency returns the given currency, else the currency of the page locale
+func (t *CommonToDYEventTranslator) currency(commonRequest *CommonRequestFormat, currency string) string {
+	if currency != "" {
+		return currency
+	}
+	requestTranslator := &CommonToDYRequestTranslator{Mappings: t.Mappings}
+	return currencyFor(commonRequest.Page.Locale, &requestTranslator.config().Defaults)
+}
+
+// eventName keeps the name of events that came from DY, else uses the dyType default
+func (t *CommonToDYEventTranslator) eventName(commonRequest *CommonRequestFormat, dyType string) string {
+	if commonRequest.Event.Source == dyEventSource && commonRequest.Event.Action != "" {
+		return commonRequest.Event.Action
+	}
+	return dyEventNames[dyType]
+}
+
+// DYEventToCommonTranslator translates DY event reporting requests into the common format.
+// The common format holds one event, so requests must report exactly one.
+type DYEventToCommonTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+// Translate performs the translation
+func (t *DYEventToCommonTranslator) Translate(dyRequest *DYEventRequest) (*CommonRequestFormat, error) {
+	if len(dyRequest.Events) != 1 {
+		return nil, fmt.Errorf("expected exactly one DY event, got %d", len(dyRequest.Events))
+	}
+	dyEvent := &dyRequest.Events[0]
+
+	// Identify events name the customer the DY user logged in as
+	var customerID string
+	if dyEvent.Properties.CUIDType == dyCUIDTypeCustomerID {
+		customerID = dyEvent.Properties.CUID
+	}
+
+	requestTranslator := &DYToCommonRequestTranslator{Mappings: t.Mappings}
+	commonRequest := &CommonRequestFormat{
+		Personalized: true,
+		Brand:        requestTranslator.config().Brand,
+		User:         requestTranslator.extractUser(&dyRequest.User),
+		Identity:     requestTranslator.extractIdentity(&dyRequest.User, customerID),
+		Session: SessionContext{
+			ID: dyRequest.Session.Dy,
+		},
+		Page:      requestTranslator.extractPage(&dyRequest.Context.Page),
+		Products:  requestTranslator.extractProducts(&dyRequest.Context.Page),
+		Device:    requestTranslator.extractDevice(&dyRequest.Context.Device),
+		Geo:       extractDYGeo(dyRequest.Context.PageAttributes),
+		Consent:   &ConsentContext{Granted: dyRequest.User.ActiveConsentAccepted},
+		Timestamp: now().UTC().Format(time.RFC3339),
+	}
+
+	switch dyEvent.Properties.DYType {
+	case DYEventTypePurchase:
+		t.extractPurchase(commonRequest, dyEvent)
+	case DYEventTypeAddToCart:
+		t.extractAddToCart(commonRequest, dyEvent)
+	case DYEventTypeLogin, DYEventTypeSignup:
+		t.extractIdentify(commonRequest, dyEvent)
+	case DYEventTypeSearch:
+		t.extractSearch(commonRequest, dyEvent)
+	default:
+		return nil, fmt.Errorf("unsupported DY event type %q", dyEvent.Properties.DYType)
+	}
+
+	// Suppress identifiers the user did not consent to share
+	return enforceConsent(commonRequest), nil
+}
+
+func (t *DYEventToCommonTranslator) extractPurchase(commonRequest *CommonRequestFormat, dyEvent *DYEvent) {
+	commonRequest.Event = EventContext{
+		Type:   "purchase",
+		Action: dyEvent.Name,
+		Source: dyEventSource,
+	}
+
+	properties := &dyEvent.Properties
+	commonRequest.Order = &OrderContext{
+		ID:       properties.UniqueTransactionID,
+		Revenue:  properties.Value,
+		Currency: properties.Currency,
+	}
+	for _, item := range properties.Cart {
+		commonRequest.Products = append(commonRequest.Products, ProductContext{
+			ID:       item.ProductID,
+			Price:    item.ItemPrice,
+			Quantity: item.Quantity,
+			Role:     ProductRolePurchased,
+		})
+	}
+}
+
+func (t *DYEventToCommonTranslator) extractAddToCart(commonRequest *CommonRequestFormat, dyEvent *DYEvent) {
+	commonRequest.Event = EventContext{
+		Type:   "add_to_cart",
+		Action: dyEvent.Name,
+		Source: dyEventSource,
+	}
+
+	// The added product replaces the page products; DY reports the line value, not the price
+	properties := &dyEvent.Properties
+	product := ProductContext{
+		ID:       properties.ProductID,
+		Currency: properties.Currency,
+		Quantity: properties.Quantity,
+		Role:     ProductRoleViewed,
+	}
+	if properties.Quantity > 0 {
+		product.Price = properties.Value / float64(properties.Quantity)
+	}
+	commonRequest.Products = []ProductContext{product}
+
+	for _, item := range properties.Cart {
+		commonRequest.Products = append(commonRequest.Products, ProductContext{
+			ID:       item.ProductID,
+			Price:    item.ItemPrice,
+			Quantity: item.Quantity,
+			Role:     ProductRoleInCart,
+		})
+	}
+}
+
+func (t *DYEventToCommonTranslator) extractIdentify(commonRequest *CommonRequestFormat, dyEvent *DYEvent) {
+	eventType := "login"
+	if dyEvent.Properties.DYType == DYEventTypeSignup {
+		eventType = "signup"
+	}
+	commonRequest.Event = EventContext{
+		Type:   eventType,
+		Action: dyEvent.Name,
+		Source: dyEventSource,
+	}
+
+	properties := &dyEvent.Properties
+	for name, value := range map[string]string{
+		dyHashedEmailAttribute: properties.HashedEmail,
+		dyCUIDAttribute:        properties.CUID,
+		dyCUIDTypeAttribute:    properties.CUIDType,
+	} {
+		if value != "" {
+			commonRequest.User.Attributes[name] = value
+		}
+	}
+}
+
+func (t *DYEventToCommonTranslator) extractSearch(commonRequest *CommonRequestFormat, dyEvent *DYEvent) {
+	commonRequest.Event = EventContext{
+		Type:   "search",
+		Action: dyEvent.Name,
+		Source: dyEventSource,
+	}
+
+	// Filters, sort and paging are only known when the search page URL carries them
+	search := extractSearch(&PageContext{Type: "search", URLInfo: commonRequest.Page.URLInfo}, nil)
+	if search == nil {
+		search = &SearchContext{}
+	}
+	search.Query = dyEvent.Properties.Keywords
+	commonRequest.Search = search
+}
+
+// UserIdentifier returns the DY user ID
+func (r *DYEventRequest) UserIdentifier() string {
+	return r.User.Dyid
+}
+
+func (r *DYEventRequest) brandHints() (string, []string, []string) {
+	productIDs := append([]string{}, r.Context.Page.Data...)
+	for _, event := range r.Events {
+		for _, item := range event.Properties.Cart {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		if event.Properties.ProductID != "" {
+			productIDs = append(productIDs, event.Properties.ProductID)
+		}
+	}
+	return "", []string{r.Context.Page.Location}, productIDs
+}
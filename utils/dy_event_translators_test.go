@@ -0,0 +1,33 @@
+package utils
+
+import "testing"
+
+func TestLoginEventHashesEmail(t *testing.T) {
+	commonRequest := &CommonRequestFormat{
+		User:  UserContext{ID: "user-1", Email: " Jane.Doe@Example.com"},
+		Event: EventContext{Type: "login", Action: "Login"},
+	}
+
+	dyRequest, err := (&CommonToDYEventTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	properties := dyRequest.Events[0].Properties
+	want := "86e0b9e56c17cc4d12387e1949b85053fbe73bc3ce5a1188713a9d300cc6133d"
+	if properties.DYType != DYEventTypeLogin || properties.HashedEmail != want {
+		t.Errorf("properties = %+v, want login-v1 with hashedEmail %s", properties, want)
+	}
+}
+
+func TestCommonToDYEventRejectsEventsWithoutDYEquivalent(t *testing.T) {
+	for _, commonRequest := range []*CommonRequestFormat{
+		{Event: EventContext{Type: "page_view"}},
+		{Event: EventContext{Type: "purchase"}},
+		{Event: EventContext{Type: "add_to_cart"}},
+	} {
+		if _, err := (&CommonToDYEventTranslator{}).Translate(commonRequest); err == nil {
+			t.Errorf("expected %q event to be rejected", commonRequest.Event.Type)
+		}
+	}
+}
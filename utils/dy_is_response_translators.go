@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ISPlacement - Placement block of an IS campaign payload
+type ISPlacement struct {
+	DisplayPriority int    `json:"displayPriority"`
+	Label           string `json:"label"`
+	Placement       string `json:"placement"`
+}
+
+// Payload keys written by the DY -> IS bridge on top of the variation data
+var dyBridgePayloadKeys = map[string]bool{
+	"campaign":                true,
+	"experience":              true,
+	"userGroup":               true,
+	"placement":               true,
+	"displayPriority":         true,
+	"itemType":                true,
+	"maximumNumberOfProducts": true,
+	"fullProductIds":          true,
+	"decisionId":              true,
+	"variationId":             true,
+	"payloadType":             true,
+}
+
+// DYToISResponseTranslator - Translates DY choose responses into the IS response shape
+// legacy clients consume. DY selector names become IS campaign names and placements, and
+// recommendation slots become payload.fullProductIds.
+type DYToISResponseTranslator struct {
+	// Placements maps DY selector names to IS placements. Unmapped selectors use the
+	// selector name as both label and placement.
+	Placements map[string]ISPlacement
+}
+
+func (t *DYToISResponseTranslator) Translate(dyResponse *DYChooseResponse) (*ISResponseFormat, error) {
+	commonResponse, err := (&DYToCommonResponseTranslator{}).Translate(dyResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dyResponse.Choices) > 0 {
+		commonResponse.RequestID = dyResponse.Choices[0].DecisionID
+	}
+
+	for i := range commonResponse.Campaigns {
+		campaign := &commonResponse.Campaigns[i]
+
+		dyPayload, ok := campaign.Payload.(DYCampaignPayload)
+		if !ok {
+			return nil, fmt.Errorf("campaign %d: unexpected payload type %T", i, campaign.Payload)
+		}
+
+		placement := t.placement(campaign.CampaignName, i)
+		payload, err := t.buildPayload(campaign, &dyPayload, placement)
+		if err != nil {
+			return nil, fmt.Errorf("campaign %d: %w", i, err)
+		}
+
+		campaign.CampaignType = "ServerSide" // IS type for API-served campaigns
+		campaign.Type = "ng"
+		campaign.Payload = payload
+	}
+
+	return (&CommonToISResponseTranslator{}).Translate(commonResponse)
+}
+
+func (t *DYToISResponseTranslator) placement(selector string, index int) ISPlacement {
+	if placement, exists := t.Placements[selector]; exists {
+		return placement
+	}
+	return ISPlacement{
+		DisplayPriority: index + 1,
+		Label:           selector,
+		Placement:       selector,
+	}
+}
+
+func (t *DYToISResponseTranslator) buildPayload(campaign *CommonCampaign, dyPayload *DYCampaignPayload, placement ISPlacement) (map[string]interface{}, error) {
+	payload := map[string]interface{}{}
+
+	variationPayload := DYVariationPayload{Type: dyPayload.PayloadType, Data: dyPayload.Data}
+	if variationPayload.Type == DYPayloadTypeRecs {
+		recs, err := variationPayload.RecsData()
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range recs.Custom {
+			payload[key] = value
+		}
+
+		productIDs := make([]string, len(recs.Slots))
+		for i, slot := range recs.Slots {
+			productIDs[i] = slot.SKU
+		}
+		payload["fullProductIds"] = productIDs
+		payload["itemType"] = "Product"
+		payload["maximumNumberOfProducts"] = len(productIDs)
+	} else if data, ok := variationPayload.Data.(map[string]interface{}); ok {
+		for key, value := range data {
+			payload[key] = value
+		}
+	}
+
+	payload["campaign"] = campaign.CampaignID
+	payload["experience"] = campaign.ExperienceID
+	payload["userGroup"] = campaign.UserGroup
+	payload["placement"] = placement
+	payload["displayPriority"] = placement.DisplayPriority
+	payload["decisionId"] = dyPayload.DecisionID
+	payload["variationId"] = dyPayload.VariationID
+	payload["payloadType"] = dyPayload.PayloadType
+
+	return payload, nil
+}
+
+// ISToDYResponseTranslator - Translates IS responses into DY choose responses, the reverse
+// of DYToISResponseTranslator. Campaigns with fullProductIds become RECS choices.
+type ISToDYResponseTranslator struct {
+	// Placements maps DY selector names to IS placements, as for DYToISResponseTranslator
+	Placements map[string]ISPlacement
+}
+
+func (t *ISToDYResponseTranslator) Translate(isResponse *ISResponseFormat) (*DYChooseResponse, error) {
+	choices := make([]DYChoice, len(isResponse.CampaignResponses))
+	for i, campaignResponse := range isResponse.CampaignResponses {
+		var payload map[string]interface{}
+		if err := remarshal(campaignResponse.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("campaign %d: invalid payload: %w", i, err)
+		}
+
+		variation := DYVariation{
+			Payload: t.buildVariationPayload(payload),
+		}
+		if id, ok := payload["variationId"].(float64); ok {
+			variation.ID = int64(id)
+		}
+
+		choiceType := DYChoiceTypeDecision
+		if variation.Payload.Type == DYPayloadTypeRecs {
+			choiceType = DYChoiceTypeRecsDecision
+		}
+
+		choice := DYChoice{
+			// IS campaign IDs are not numeric unless they came from DY
+			ID:         derivedChoiceID(campaignResponse.CampaignID),
+			Name:       t.selector(campaignResponse.CampaignName, payload),
+			Type:       choiceType,
+			Variations: []DYVariation{variation},
+		}
+		if decisionID, ok := payload["decisionId"].(string); ok {
+			choice.DecisionID = decisionID
+		}
+
+		choices[i] = choice
+	}
+
+	dyResponse := &DYChooseResponse{
+		Choices: choices,
+	}
+	if isResponse.ResolvedUserID != "" {
+		dyResponse.Cookies = []DYCookie{{Name: dyServerCookie, Value: isResponse.ResolvedUserID}}
+	}
+
+	return dyResponse, nil
+}
+
+func (t *ISToDYResponseTranslator) selector(campaignName string, payload map[string]interface{}) string {
+	placement, ok := payload["placement"].(map[string]interface{})
+	if !ok {
+		return campaignName
+	}
+	name, _ := placement["placement"].(string)
+
+	// Several selectors may map to one placement; the first in name order wins
+	selectors := make([]string, 0, len(t.Placements))
+	for selector := range t.Placements {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+	for _, selector := range selectors {
+		if t.Placements[selector].Placement == name {
+			return selector
+		}
+	}
+	if name != "" {
+		return name
+	}
+	return campaignName
+}
+
+func (t *ISToDYResponseTranslator) buildVariationPayload(payload map[string]interface{}) DYVariationPayload {
+	// Everything the bridge did not add is variation data
+	data := map[string]interface{}{}
+	for key, value := range payload {
+		if !dyBridgePayloadKeys[key] {
+			data[key] = value
+		}
+	}
+
+	payloadType, _ := payload["payloadType"].(string)
+
+	productIDs, hasProducts := payload["fullProductIds"].([]interface{})
+	if !hasProducts && payloadType != DYPayloadTypeRecs {
+		if payloadType == "" {
+			payloadType = DYPayloadTypeCustomJSON
+		}
+		return DYVariationPayload{Type: payloadType, Data: data}
+	}
+
+	recs := DYRecsData{
+		Slots: make([]DYRecsSlot, 0, len(productIDs)),
+	}
+	if len(data) > 0 {
+		recs.Custom = data
+	}
+	for _, productID := range productIDs {
+		if sku, ok := productID.(string); ok {
+			recs.Slots = append(recs.Slots, DYRecsSlot{SKU: sku})
+		}
+	}
+
+	return DYVariationPayload{Type: DYPayloadTypeRecs, Data: recs}
+}
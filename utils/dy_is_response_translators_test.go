@@ -0,0 +1,67 @@
+package utils
+
+import "testing"
+
+func TestISToDYSelectorIsDeterministic(t *testing.T) {
+	translator := &ISToDYResponseTranslator{
+		Placements: map[string]ISPlacement{
+			"PDP Recs":     {Placement: "pdpRecs"},
+			"PDP Recs Alt": {Placement: "pdpRecs"},
+			"Cart Recs":    {Placement: "cartRecs"},
+		},
+	}
+	isResponse := &ISResponseFormat{
+		CampaignResponses: []ISCampaignResponse{{
+			CampaignID:   "2fwcc",
+			CampaignName: "PDP - Similar Items",
+			Payload: map[string]interface{}{
+				"placement":      map[string]interface{}{"placement": "pdpRecs"},
+				"fullProductIds": []interface{}{"AN-1"},
+			},
+		}},
+	}
+
+	// Map order varies between runs; repeat to catch a selector picked by it
+	for i := 0; i < 50; i++ {
+		dyResponse, err := translator.Translate(isResponse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := dyResponse.Choices[0].Name; name != "PDP Recs" {
+			t.Fatalf("run %d: selector = %q, want PDP Recs", i, name)
+		}
+	}
+}
+
+func TestISToDYChoiceIDsAreDistinctAndStable(t *testing.T) {
+	isResponse := &ISResponseFormat{
+		CampaignResponses: []ISCampaignResponse{
+			{CampaignID: "2fwcc", CampaignName: "PDP - Similar Items", Payload: map[string]interface{}{}},
+			{CampaignID: "7hk2p", CampaignName: "PDP - Complete the Look", Payload: map[string]interface{}{}},
+			{CampaignID: "1234567", CampaignName: "DY Campaign", Payload: map[string]interface{}{}},
+		},
+	}
+
+	first, err := (&ISToDYResponseTranslator{}).Translate(isResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := (&ISToDYResponseTranslator{}).Translate(isResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int64]bool{}
+	for i, choice := range first.Choices {
+		if choice.ID <= 0 || seen[choice.ID] {
+			t.Errorf("choice %d: id %d is not a distinct positive ID", i, choice.ID)
+		}
+		seen[choice.ID] = true
+		if second.Choices[i].ID != choice.ID {
+			t.Errorf("choice %d: id %d, then %d", i, choice.ID, second.Choices[i].ID)
+		}
+	}
+	if id := first.Choices[2].ID; id != 1234567 {
+		t.Errorf("numeric campaign ID became choice %d", id)
+	}
+}
@@ -1,6 +1,21 @@
 package utils
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// dyEventSource is the common event source of requests translated from DY
+const dyEventSource = "Dynamic Yield"
+
+// DY page types (context.page.type)
+const (
+	DYPageTypeHomepage = "HOMEPAGE"
+	DYPageTypeCategory = "CATEGORY"
+	DYPageTypeProduct  = "PRODUCT"
+	DYPageTypeCart     = "CART"
+	DYPageTypeOther    = "OTHER"
+)
 
 // DYChooseRequest represents the request payload for the Dynamic Yield choose API
 type DYChooseRequest struct {
@@ -25,8 +40,9 @@ type DYSession struct {
 
 // DYContext represents the context object in the DY request
 type DYContext struct {
-	Page   DYPage   `json:"page"`
-	Device DYDevice `json:"device"`
+	Page           DYPage            `json:"page"`
+	Device         DYDevice          `json:"device"`
+	PageAttributes map[string]string `json:"pageAttributes,omitempty"`
 }
 
 // DYPage represents the page object in the DY request
@@ -34,6 +50,7 @@ type DYPage struct {
 	Type     string   `json:"type"`
 	Data     []string `json:"data"`
 	Location string   `json:"location"`
+	Locale   string   `json:"locale,omitempty"`
 }
 
 // DYDevice represents the device object in the DY request
@@ -64,54 +81,37 @@ type DYRecsProductData struct {
 }
 
 // CommonToDYRequestTranslator translates from the common format to the DY format
-type CommonToDYRequestTranslator struct{}
+type CommonToDYRequestTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
 
-// Translate performs the translation
-func (t *CommonToDYRequestTranslator) Translate(commonRequest *CommonRequestFormat) (*DYChooseRequest, error) {
-	user := DYUser{
-		Dyid: commonRequest.User.ID,
-	}
-	if val, ok := commonRequest.User.Attributes["active_consent_accepted"].(bool); ok {
-		user.ActiveConsentAccepted = val
-	}
-	if val, ok := commonRequest.User.Attributes["dyid_server"].(string); ok {
-		user.DyidServer = val
+func (t *CommonToDYRequestTranslator) config() *MappingConfig {
+	if t.Mappings != nil {
+		return t.Mappings
 	}
+	return CurrentMappings()
+}
 
-	session := DYSession{
-		Dy: commonRequest.Session.ID,
-	}
+func (t *CommonToDYRequestTranslator) mappings() *DYMappings {
+	return &t.config().DY
+}
 
-	pageType := "OTHER"
-	switch commonRequest.Page.Type {
-	case "homepage":
-		pageType = "HOMEPAGE"
-	case "product":
-		pageType = "PRODUCT"
-	}
+// Translate performs the translation
+func (t *CommonToDYRequestTranslator) Translate(commonRequest *CommonRequestFormat) (*DYChooseRequest, error) {
+	// Suppress identifiers the user did not consent to share
+	commonRequest = enforceConsent(commonRequest)
 
-	var productData []string
-	for _, product := range commonRequest.Products {
-		productData = append(productData, product.ID)
-	}
+	user := t.buildUser(commonRequest)
 
-	page := DYPage{
-		Type:     pageType,
-		Location: commonRequest.Page.URL,
-		Data:     productData,
+	session := DYSession{
+		Dy: commonRequest.Session.ID,
 	}
 
-	device := DYDevice{
-		UserAgent: commonRequest.Device.UserAgent,
-		Type:      commonRequest.Device.Type,
-		Browser:   commonRequest.Device.Platform, // Assuming platform is the browser
-		Ip:        commonRequest.Device.IP,
-	}
+	context := t.buildContext(commonRequest)
 
-	context := DYContext{
-		Page:   page,
-		Device: device,
-	}
+	// Search events carry the keyword themselves; choose requests carry it for targeting
+	context.PageAttributes = addDYSearchAttribute(context.PageAttributes, commonRequest.Search)
 
 	selector := DYSelector{}
 	if val, ok := commonRequest.Queries["selector"].(map[string]interface{}); ok {
@@ -162,73 +162,233 @@ func (t *CommonToDYRequestTranslator) Translate(commonRequest *CommonRequestForm
 	return dyRequest, nil
 }
 
+// buildUser maps the common user onto the DY user, restoring the DY-only attributes
+func (t *CommonToDYRequestTranslator) buildUser(commonRequest *CommonRequestFormat) DYUser {
+	// Prefer the DY IDs of the identity, which may be linked to a user from another format
+	user := DYUser{
+		Dyid:       firstNonEmpty(commonRequest.Identity.Value(NamespaceDY), commonRequest.User.ID),
+		DyidServer: commonRequest.Identity.Value(NamespaceDYServer),
+	}
+	// The consent section is authoritative for the consent flag
+	if commonRequest.Consent != nil {
+		user.ActiveConsentAccepted = commonRequest.Consent.Granted
+	} else if val, ok := commonRequest.User.Attributes["active_consent_accepted"].(bool); ok {
+		user.ActiveConsentAccepted = val
+	}
+	if val, ok := commonRequest.User.Attributes["dyid_server"].(string); ok && user.DyidServer == "" {
+		user.DyidServer = val
+	}
+	return user
+}
+
+// buildContext maps the common page, device and geo onto the DY context
+func (t *CommonToDYRequestTranslator) buildContext(commonRequest *CommonRequestFormat) DYContext {
+	mappings := t.mappings()
+	pageType, exists := mappings.CommonPageTypeToDY[commonRequest.Page.Type]
+	if !exists {
+		pageType = mappings.DefaultPageType
+	}
+
+	page := DYPage{
+		Type:     pageType,
+		Location: commonRequest.Page.URL,
+		Locale:   uoLocale(commonRequest.Page.Locale),
+		Data:     t.buildPageData(pageType, commonRequest),
+	}
+
+	// Classify the user agent for common devices that were not classified on the way in
+	commonDevice := commonRequest.Device
+	classifyDevice(&commonDevice, "")
+
+	device := DYDevice{
+		UserAgent: commonDevice.UserAgent,
+		Type:      strings.ToUpper(commonDevice.Type),
+		Browser:   commonDevice.Browser,
+		Ip:        commonDevice.IP,
+	}
+
+	return DYContext{
+		Page:           page,
+		Device:         device,
+		PageAttributes: buildDYGeoAttributes(commonRequest.Geo),
+	}
+}
+
+// buildPageData fills context.page.data as DY expects for the page type: the category path
+// on CATEGORY pages, the cart SKUs on CART pages, nothing on HOMEPAGE and the viewed SKUs
+// otherwise
+func (t *CommonToDYRequestTranslator) buildPageData(pageType string, commonRequest *CommonRequestFormat) []string {
+	data := []string{}
+
+	switch pageType {
+	case DYPageTypeHomepage:
+		return data
+	case DYPageTypeCategory:
+		if len(commonRequest.Page.CategoryPath) == 0 && commonRequest.Page.URLInfo != nil && commonRequest.Page.URLInfo.CategorySlug != "" {
+			return append(data, commonRequest.Page.URLInfo.CategorySlug)
+		}
+		return append(data, commonRequest.Page.CategoryPath...)
+	case DYPageTypeCart:
+		for _, product := range productsWithRole(commonRequest.Products, ProductRoleInCart) {
+			data = append(data, product.ID)
+		}
+	default:
+		for _, product := range productsWithRole(commonRequest.Products, ProductRoleViewed) {
+			data = append(data, product.ID)
+		}
+	}
+
+	return data
+}
+
 // DYToCommonRequestTranslator translates from the DY format to the common format
-type DYToCommonRequestTranslator struct{}
+type DYToCommonRequestTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+func (t *DYToCommonRequestTranslator) config() *MappingConfig {
+	if t.Mappings != nil {
+		return t.Mappings
+	}
+	return CurrentMappings()
+}
+
+func (t *DYToCommonRequestTranslator) mappings() *DYMappings {
+	return &t.config().DY
+}
 
 // Translate performs the translation
 func (t *DYToCommonRequestTranslator) Translate(dyRequest *DYChooseRequest) (*CommonRequestFormat, error) {
-	user := UserContext{
-		ID: dyRequest.User.Dyid,
-		Attributes: map[string]interface{}{
-			"active_consent_accepted": dyRequest.User.ActiveConsentAccepted,
-			"dyid_server":             dyRequest.User.DyidServer,
-		},
-	}
+	user := t.extractUser(&dyRequest.User)
+	identity := t.extractIdentity(&dyRequest.User, "")
 
 	session := SessionContext{
 		ID: dyRequest.Session.Dy,
 	}
 
-	eventType := "page_view"
-	if dyRequest.Context.Page.Type == "PRODUCT" {
-		eventType = "product_view"
+	mappings := t.mappings()
+	eventType, exists := mappings.PageTypeToEventType[dyRequest.Context.Page.Type]
+	if !exists {
+		eventType = mappings.DefaultEventType
 	}
 
 	event := EventContext{
 		Type:   eventType,
 		Action: dyRequest.Context.Page.Type,
-		Source: "Dynamic Yield",
+		Source: dyEventSource,
 	}
 
-	pageType := "other"
-	switch dyRequest.Context.Page.Type {
-	case "HOMEPAGE":
-		pageType = "homepage"
-	case "PRODUCT":
-		pageType = "product"
-	}
-
-	page := PageContext{
-		Type: pageType,
-		URL:  dyRequest.Context.Page.Location,
-	}
-
-	var products []ProductContext
-	for _, productID := range dyRequest.Context.Page.Data {
-		products = append(products, ProductContext{ID: productID})
-	}
+	page := t.extractPage(&dyRequest.Context.Page)
+	products := t.extractProducts(&dyRequest.Context.Page)
+	device := t.extractDevice(&dyRequest.Context.Device)
+	geo := extractDYGeo(dyRequest.Context.PageAttributes)
 
-	device := DeviceContext{
-		UserAgent: dyRequest.Context.Device.UserAgent,
-		Type:      dyRequest.Context.Device.Type,
-		Platform:  dyRequest.Context.Device.Browser, // Assuming browser is the platform
-		IP:        dyRequest.Context.Device.Ip,
+	// OTHER pages carrying a search keyword are search pages
+	search := extractDYSearch(dyRequest.Context.PageAttributes)
+	if search != nil && page.Type == mappings.DefaultCommonPageType {
+		page.Type = "search"
 	}
 
 	commonRequest := &CommonRequestFormat{
 		Personalized: true,
+		Brand:        t.config().Brand,
 		User:         user,
+		Identity:     identity,
 		Session:      session,
 		Event:        event,
 		Page:         page,
+		Search:       search,
 		Products:     products,
 		Device:       device,
-		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Geo:          geo,
+		Consent:      &ConsentContext{Granted: dyRequest.User.ActiveConsentAccepted},
+		Timestamp:    now().UTC().Format(time.RFC3339),
 		Queries: map[string]interface{}{
 			"selector": dyRequest.Selector,
 			"options":  dyRequest.Options,
 		},
 	}
 
-	return commonRequest, nil
+	// Suppress identifiers the user did not consent to share
+	return enforceConsent(commonRequest), nil
+}
+
+func (t *DYToCommonRequestTranslator) extractUser(dyUser *DYUser) UserContext {
+	return UserContext{
+		ID: dyUser.Dyid,
+		Attributes: map[string]interface{}{
+			"active_consent_accepted": dyUser.ActiveConsentAccepted,
+			"dyid_server":             dyUser.DyidServer,
+		},
+	}
+}
+
+// extractIdentity resolves the identity of the DY user, with the customer ID when the
+// request identifies one. Only users who accepted tracking are linked in the store.
+func (t *DYToCommonRequestTranslator) extractIdentity(dyUser *DYUser, customerID string) *IdentityContext {
+	return resolveIdentity(map[string]string{
+		NamespaceDY:       dyUser.Dyid,
+		NamespaceDYServer: dyUser.DyidServer,
+		NamespaceCustomer: customerID,
+	}, dyUser.ActiveConsentAccepted)
+}
+
+func (t *DYToCommonRequestTranslator) extractPage(dyPage *DYPage) PageContext {
+	mappings := t.mappings()
+	urlInfo := parsePageURL(dyPage.Location)
+	pageType, exists := mappings.PageTypeToCommon[dyPage.Type]
+	if !exists {
+		pageType = mappings.DefaultCommonPageType
+		if urlInfo != nil {
+			pageType = urlInfo.PageType
+		}
+	}
+
+	page := PageContext{
+		Type:     pageType,
+		URL:      dyPage.Location,
+		Language: localeLanguage(dyPage.Locale),
+		Locale:   NormalizeLocale(dyPage.Locale),
+		URLInfo:  urlInfo,
+	}
+	if dyPage.Type == DYPageTypeCategory && len(dyPage.Data) > 0 {
+		page.CategoryPath = dyPage.Data
+	}
+	return page
+}
+
+// extractProducts reads products from context.page.data: the cart on CART pages, viewed
+// products on any page type other than CATEGORY, whose data is the category path
+func (t *DYToCommonRequestTranslator) extractProducts(dyPage *DYPage) []ProductContext {
+	role := ProductRoleViewed
+	switch dyPage.Type {
+	case DYPageTypeCategory:
+		return nil
+	case DYPageTypeCart:
+		role = ProductRoleInCart
+	}
+
+	var products []ProductContext
+	for _, productID := range dyPage.Data {
+		products = append(products, ProductContext{ID: productID, Role: role})
+	}
+	return products
+}
+
+func (t *DYToCommonRequestTranslator) extractDevice(dyDevice *DYDevice) DeviceContext {
+	device := DeviceContext{
+		UserAgent: dyDevice.UserAgent,
+		Type:      strings.ToLower(dyDevice.Type),
+		Platform:  "web",
+		Browser:   dyDevice.Browser,
+		IP:        dyDevice.Ip,
+	}
+	classifyDevice(&device, "")
+	return device
+}
+
+// UserIdentifier returns the DY user ID
+func (r *DYChooseRequest) UserIdentifier() string {
+	return r.User.Dyid
 }
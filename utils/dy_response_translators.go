@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+)
+
+// DY choice types
+const (
+	DYChoiceTypeDecision     = "DECISION"
+	DYChoiceTypeRecsDecision = "RECS_DECISION"
+)
+
+// DY variation payload types
+const (
+	DYPayloadTypeCustomJSON = "CUSTOM_JSON"
+	DYPayloadTypeRecs       = "RECS"
+	DYPayloadTypeHTML       = "HTML"
+)
+
+// dyServerCookie is the DY cookie carrying the server-side user ID
+const dyServerCookie = "_dyid_server"
+
+// DYChooseResponse represents the response payload of the Dynamic Yield choose API
+type DYChooseResponse struct {
+	Choices []DYChoice `json:"choices"`
+	Cookies []DYCookie `json:"cookies,omitempty"`
+}
+
+// DYChoice represents a single selector decision in the DY response
+type DYChoice struct {
+	ID         int64         `json:"id"`
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	DecisionID string        `json:"decisionId"`
+	Variations []DYVariation `json:"variations"`
+	Groups     []string      `json:"groups,omitempty"`
+}
+
+// DYVariation represents a chosen variation of a DY choice
+type DYVariation struct {
+	ID                int64                `json:"id"`
+	Payload           DYVariationPayload   `json:"payload"`
+	AnalyticsMetadata *DYAnalyticsMetadata `json:"analyticsMetadata,omitempty"`
+}
+
+// DYVariationPayload represents the typed payload of a DY variation
+type DYVariationPayload struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// DYRecsData represents the data of a RECS variation payload
+type DYRecsData struct {
+	Custom map[string]interface{} `json:"custom,omitempty"`
+	Slots  []DYRecsSlot           `json:"slots"`
+}
+
+// DYRecsSlot represents a single recommended product in a RECS payload
+type DYRecsSlot struct {
+	SKU         string                 `json:"sku"`
+	SlotID      string                 `json:"slotId"`
+	ProductData map[string]interface{} `json:"productData,omitempty"`
+}
+
+// DYAnalyticsMetadata represents the analytics metadata returned when requested in choose options
+type DYAnalyticsMetadata struct {
+	CampaignID     int64    `json:"campaignId"`
+	CampaignName   string   `json:"campaignName"`
+	ExperienceID   int64    `json:"experienceId"`
+	ExperienceName string   `json:"experienceName"`
+	VariationIDs   []int64  `json:"variationIds"`
+	VariationNames []string `json:"variationNames"`
+}
+
+// DYCookie represents a cookie DY asks the caller to set
+type DYCookie struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+// DYCampaignPayload is the CommonCampaign payload produced for a DY variation.
+// It keeps the DY decision data needed to rebuild the choice on the way back.
+type DYCampaignPayload struct {
+	DecisionID        string               `json:"decisionId"`
+	VariationID       int64                `json:"variationId"`
+	PayloadType       string               `json:"payloadType"`
+	Data              interface{}          `json:"data"`
+	Groups            []string             `json:"groups,omitempty"`
+	AnalyticsMetadata *DYAnalyticsMetadata `json:"analyticsMetadata,omitempty"`
+}
+
+// RecsData decodes the variation data as RECS data
+func (p *DYVariationPayload) RecsData() (*DYRecsData, error) {
+	if p.Type != DYPayloadTypeRecs {
+		return nil, fmt.Errorf("payload type %q is not %s", p.Type, DYPayloadTypeRecs)
+	}
+	recs := &DYRecsData{}
+	if err := remarshal(p.Data, recs); err != nil {
+		return nil, fmt.Errorf("invalid RECS payload: %w", err)
+	}
+	return recs, nil
+}
+
+// DYToCommonResponseTranslator translates a DY choose response to the common response format
+type DYToCommonResponseTranslator struct{}
+
+// Translate performs the translation, producing one campaign per chosen variation
+func (t *DYToCommonResponseTranslator) Translate(dyResponse *DYChooseResponse) (*CommonResponseFormat, error) {
+	campaigns := []CommonCampaign{}
+	for _, choice := range dyResponse.Choices {
+		for _, variation := range choice.Variations {
+			campaigns = append(campaigns, t.buildCampaign(&choice, &variation))
+		}
+	}
+
+	commonResponse := &CommonResponseFormat{
+		Campaigns: campaigns,
+	}
+	for _, cookie := range dyResponse.Cookies {
+		if cookie.Name == dyServerCookie {
+			commonResponse.UserID = cookie.Value
+		}
+	}
+
+	return commonResponse, nil
+}
+
+func (t *DYToCommonResponseTranslator) buildCampaign(choice *DYChoice, variation *DYVariation) CommonCampaign {
+	campaign := CommonCampaign{
+		CampaignID:    strconv.FormatInt(choice.ID, 10),
+		CampaignName:  choice.Name, // DY selector name
+		CampaignType:  choice.Type,
+		State:         "Published", // DY only returns live campaigns
+		Type:          FormatDY,
+		UserGroup:     "Default",
+		TemplateNames: []string{},
+		Payload: DYCampaignPayload{
+			DecisionID:        choice.DecisionID,
+			VariationID:       variation.ID,
+			PayloadType:       variation.Payload.Type,
+			Data:              variation.Payload.Data,
+			Groups:            choice.Groups,
+			AnalyticsMetadata: variation.AnalyticsMetadata,
+		},
+	}
+
+	if metadata := variation.AnalyticsMetadata; metadata != nil {
+		campaign.ExperienceID = strconv.FormatInt(metadata.ExperienceID, 10)
+		campaign.ExperienceName = metadata.ExperienceName
+		if len(metadata.VariationNames) > 0 {
+			campaign.TemplateNames = metadata.VariationNames
+		}
+	}
+
+	return campaign
+}
+
+// CommonToDYResponseTranslator translates the common response format to a DY choose response
+type CommonToDYResponseTranslator struct{}
+
+// Translate performs the translation, grouping consecutive campaigns of the same choice
+func (t *CommonToDYResponseTranslator) Translate(commonResponse *CommonResponseFormat) (*DYChooseResponse, error) {
+	choices := []DYChoice{}
+	for i, campaign := range commonResponse.Campaigns {
+		// Campaigns of other vendors are converted as the IS bridge converts them
+		if campaign.Type != FormatDY {
+			choice, err := t.buildForeignChoice(&campaign)
+			if err != nil {
+				return nil, fmt.Errorf("campaign %d: %w", i, err)
+			}
+			choices = append(choices, choice)
+			continue
+		}
+
+		var payload DYCampaignPayload
+		if err := remarshal(campaign.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("campaign %d: invalid DY payload: %w", i, err)
+		}
+
+		choiceID, err := strconv.ParseInt(campaign.CampaignID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("campaign %d: campaignId %q is not a DY choice ID", i, campaign.CampaignID)
+		}
+
+		variation := DYVariation{
+			ID: payload.VariationID,
+			Payload: DYVariationPayload{
+				Type: payload.PayloadType,
+				Data: payload.Data,
+			},
+			AnalyticsMetadata: payload.AnalyticsMetadata,
+		}
+
+		if last := len(choices) - 1; last >= 0 && choices[last].ID == choiceID {
+			choices[last].Variations = append(choices[last].Variations, variation)
+			continue
+		}
+
+		choices = append(choices, DYChoice{
+			ID:         choiceID,
+			Name:       campaign.CampaignName,
+			Type:       t.choiceType(campaign.CampaignType, payload.PayloadType),
+			DecisionID: payload.DecisionID,
+			Variations: []DYVariation{variation},
+			Groups:     payload.Groups,
+		})
+	}
+
+	dyResponse := &DYChooseResponse{
+		Choices: choices,
+	}
+	if commonResponse.UserID != "" {
+		dyResponse.Cookies = []DYCookie{{Name: dyServerCookie, Value: commonResponse.UserID}}
+	}
+
+	return dyResponse, nil
+}
+
+// buildForeignChoice builds the choice of a campaign that did not come from DY. Its ID,
+// not being a DY choice ID, is replaced by one derived from it, and its payload becomes
+// the variation data: RECS for product recommendations, CUSTOM_JSON otherwise.
+func (t *CommonToDYResponseTranslator) buildForeignChoice(campaign *CommonCampaign) (DYChoice, error) {
+	var payload map[string]interface{}
+	if err := remarshal(campaign.Payload, &payload); err != nil {
+		return DYChoice{}, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	bridge := &ISToDYResponseTranslator{}
+	variation := DYVariation{
+		Payload: bridge.buildVariationPayload(payload),
+	}
+	choiceType := DYChoiceTypeDecision
+	if variation.Payload.Type == DYPayloadTypeRecs {
+		choiceType = DYChoiceTypeRecsDecision
+	}
+
+	return DYChoice{
+		ID:         derivedChoiceID(campaign.CampaignID),
+		Name:       bridge.selector(campaign.CampaignName, payload),
+		Type:       choiceType,
+		Variations: []DYVariation{variation},
+	}, nil
+}
+
+// derivedChoiceID returns the campaign ID itself when it is numeric, else a stable
+// positive ID hashed from it, kept within the integers JSON numbers represent exactly
+func derivedChoiceID(campaignID string) int64 {
+	if id, err := strconv.ParseInt(campaignID, 10, 64); err == nil {
+		return id
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(campaignID))
+	return int64(hash.Sum64() & (1<<53 - 1))
+}
+
+func (t *CommonToDYResponseTranslator) choiceType(campaignType, payloadType string) string {
+	switch campaignType {
+	case DYChoiceTypeDecision, DYChoiceTypeRecsDecision:
+		return campaignType
+	}
+	if payloadType == DYPayloadTypeRecs {
+		return DYChoiceTypeRecsDecision
+	}
+	return DYChoiceTypeDecision
+}
+
+// remarshal converts between loosely typed JSON values and typed structs
+func remarshal(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// UserIdentifier returns the DY server-side user ID cookie value
+func (r *DYChooseResponse) UserIdentifier() string {
+	for _, cookie := range r.Cookies {
+		if cookie.Name == dyServerCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// RequestExtensions - Source fields the Common format cannot represent, kept per origin
+// format so that reverse translation back to that format is lossless
+type RequestExtensions struct {
+	UO *UOExtensions `json:"uo,omitempty"`
+}
+
+// UOExtensions - Unmapped isEvent fields captured by UOToCommonTranslator and consulted
+// by CommonToUOTranslator. Mapped Common sections still take precedence when they have
+// been changed since translation.
+type UOExtensions struct {
+	Locale              string                `json:"locale"`
+	Channel             string                `json:"channel"`
+	PageType            string                `json:"pageType"`
+	UserAttributes      IsEventUserAttributes `json:"userAttributes"`
+	Flags               IsEventFlags          `json:"flags"`
+	Catalog             *IsEventCatalog       `json:"catalog,omitempty"`
+	EmptyCart           *IsEventCart          `json:"emptyCart,omitempty"`
+	Device              *IsEventDevice        `json:"device,omitempty"`
+	TimestampGenerated  bool                  `json:"timestampGenerated,omitempty"`
+	PersonalizedOmitted bool                  `json:"personalizedOmitted,omitempty"`
+
+	// Keys the UO structs do not model, as raw JSON, by the path of their object:
+	// "$", "$.isEvent", "$.isEvent.source" or "$.isEvent.user". Unmodeled user attributes
+	// and device keys travel with UserAttributes and Device.
+	Unmapped map[string]map[string]json.RawMessage `json:"unmapped,omitempty"`
+}
+
+// Paths of the UO objects whose unmodeled keys UOExtensions keeps
+const (
+	uoPathRoot    = "$"
+	uoPathIsEvent = "$.isEvent"
+	uoPathSource  = "$.isEvent.source"
+	uoPathUser    = "$.isEvent.user"
+)
+
+// The UO structs below decode the keys they do not model into Unmapped and encode them
+// back, so that fields added to UO payloads survive a round trip through Common
+
+func (r *UOCurrentRequestFormat) UnmarshalJSON(data []byte) error {
+	type fields UOCurrentRequestFormat
+	unmapped, err := decodeUnmapped(data, (*fields)(r))
+	r.Unmapped = unmapped
+	return err
+}
+
+func (r UOCurrentRequestFormat) MarshalJSON() ([]byte, error) {
+	type fields UOCurrentRequestFormat
+	return encodeUnmapped(fields(r), r.Unmapped)
+}
+
+func (c *IsEventContext) UnmarshalJSON(data []byte) error {
+	type fields IsEventContext
+	unmapped, err := decodeUnmapped(data, (*fields)(c))
+	c.Unmapped = unmapped
+	return err
+}
+
+func (c IsEventContext) MarshalJSON() ([]byte, error) {
+	type fields IsEventContext
+	return encodeUnmapped(fields(c), c.Unmapped)
+}
+
+func (s *IsEventSource) UnmarshalJSON(data []byte) error {
+	type fields IsEventSource
+	unmapped, err := decodeUnmapped(data, (*fields)(s))
+	s.Unmapped = unmapped
+	return err
+}
+
+func (s IsEventSource) MarshalJSON() ([]byte, error) {
+	type fields IsEventSource
+	return encodeUnmapped(fields(s), s.Unmapped)
+}
+
+func (u *IsEventUser) UnmarshalJSON(data []byte) error {
+	type fields IsEventUser
+	unmapped, err := decodeUnmapped(data, (*fields)(u))
+	u.Unmapped = unmapped
+	return err
+}
+
+func (u IsEventUser) MarshalJSON() ([]byte, error) {
+	type fields IsEventUser
+	return encodeUnmapped(fields(u), u.Unmapped)
+}
+
+func (a *IsEventUserAttributes) UnmarshalJSON(data []byte) error {
+	type fields IsEventUserAttributes
+	unmapped, err := decodeUnmapped(data, (*fields)(a))
+	a.Unmapped = unmapped
+	return err
+}
+
+func (a IsEventUserAttributes) MarshalJSON() ([]byte, error) {
+	type fields IsEventUserAttributes
+	return encodeUnmapped(fields(a), a.Unmapped)
+}
+
+func (d *IsEventDevice) UnmarshalJSON(data []byte) error {
+	type fields IsEventDevice
+	unmapped, err := decodeUnmapped(data, (*fields)(d))
+	d.Unmapped = unmapped
+	return err
+}
+
+func (d IsEventDevice) MarshalJSON() ([]byte, error) {
+	type fields IsEventDevice
+	return encodeUnmapped(fields(d), d.Unmapped)
+}
+
+// decodeUnmapped decodes a JSON object into fields, a pointer to a struct, and returns
+// the keys none of its fields take, or nil when there are none
+func decodeUnmapped(data []byte, fields interface{}) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, fields); err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return nil, err
+	}
+
+	// encoding/json matches keys to fields regardless of case
+	names := jsonFieldNames(reflect.TypeOf(fields).Elem())
+	for key := range object {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				delete(object, key)
+				break
+			}
+		}
+	}
+	if len(object) == 0 {
+		return nil, nil
+	}
+	return object, nil
+}
+
+// encodeUnmapped encodes fields, a struct, as a JSON object with the unmapped keys added.
+// Modeled fields win over unmapped keys of the same name.
+func encodeUnmapped(fields interface{}, unmapped map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(fields)
+	if err != nil || len(unmapped) == 0 {
+		return data, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	for key, value := range unmapped {
+		if _, exists := object[key]; !exists {
+			object[key] = value
+		}
+	}
+	return json.Marshal(object)
+}
+
+// jsonFieldNames returns the JSON keys of a struct's fields
+func jsonFieldNames(structType reflect.Type) []string {
+	var names []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !field.IsExported():
+			continue
+		case name == "":
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
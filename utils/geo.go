@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+)
+
+// GeoContext - Where the shopper is and which market they shop in
+type GeoContext struct {
+	CountryCode string `json:"countryCode,omitempty"`
+	RegionCode  string `json:"regionCode,omitempty"`
+	City        string `json:"city,omitempty"`
+	PostalCode  string `json:"postalCode,omitempty"`
+}
+
+// bestMatch keys carrying the geo lookup of the request
+const (
+	bestMatchCountry  = "country"
+	bestMatchRegion   = "region"
+	bestMatchCity     = "city"
+	bestMatchZipCodes = "zipCodes"
+)
+
+// DY page attributes carrying the geo context, for location targeting
+const (
+	dyGeoCountryAttribute    = "geoCountry"
+	dyGeoRegionAttribute     = "geoRegion"
+	dyGeoCityAttribute       = "geoCity"
+	dyGeoPostalCodeAttribute = "geoPostalCode"
+)
+
+// extractGeo builds the geo context from the bestMatch geo lookup and the country and
+// region of the user attributes. The user attributes name the market the shopper chose,
+// so they win over the lookup; when the countries disagree, the looked-up region, city
+// and postal code belong to another country and are dropped.
+func extractGeo(bestMatch map[string]interface{}, countryCode, regionCode string) *GeoContext {
+	lookup := GeoContext{
+		CountryCode: strings.ToUpper(stringValue(bestMatch[bestMatchCountry])),
+		RegionCode:  strings.ToUpper(stringValue(bestMatch[bestMatchRegion])),
+		City:        stringValue(bestMatch[bestMatchCity]),
+	}
+	// zipCodes may list several codes; the first is the best match
+	if zipCodes := stringValue(bestMatch[bestMatchZipCodes]); zipCodes != "" {
+		lookup.PostalCode = strings.TrimSpace(strings.Split(zipCodes, ",")[0])
+	}
+
+	geo := lookup
+	if countryCode != "" {
+		geo.CountryCode = strings.ToUpper(countryCode)
+		if lookup.CountryCode != "" && lookup.CountryCode != geo.CountryCode {
+			geo = GeoContext{CountryCode: geo.CountryCode}
+		}
+	}
+	if regionCode != "" {
+		geo.RegionCode = strings.ToUpper(regionCode)
+	}
+
+	if geo == (GeoContext{}) {
+		return nil
+	}
+	return &geo
+}
+
+// buildBestMatchGeo returns the bestMatch geo keys for the geo context
+func buildBestMatchGeo(geo *GeoContext) map[string]interface{} {
+	bestMatch := map[string]interface{}{}
+	for key, value := range map[string]string{
+		bestMatchCountry:  geo.CountryCode,
+		bestMatchRegion:   geo.RegionCode,
+		bestMatchCity:     geo.City,
+		bestMatchZipCodes: geo.PostalCode,
+	} {
+		if value != "" {
+			bestMatch[key] = value
+		}
+	}
+	return bestMatch
+}
+
+// buildDYGeoAttributes returns the DY page attributes for the geo context
+func buildDYGeoAttributes(geo *GeoContext) map[string]string {
+	if geo == nil {
+		return nil
+	}
+	attributes := map[string]string{}
+	for key, value := range map[string]string{
+		dyGeoCountryAttribute:    geo.CountryCode,
+		dyGeoRegionAttribute:     geo.RegionCode,
+		dyGeoCityAttribute:       geo.City,
+		dyGeoPostalCodeAttribute: geo.PostalCode,
+	} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+// extractDYGeo reads the geo context back from DY page attributes
+func extractDYGeo(attributes map[string]string) *GeoContext {
+	geo := GeoContext{
+		CountryCode: attributes[dyGeoCountryAttribute],
+		RegionCode:  attributes[dyGeoRegionAttribute],
+		City:        attributes[dyGeoCityAttribute],
+		PostalCode:  attributes[dyGeoPostalCodeAttribute],
+	}
+	if geo == (GeoContext{}) {
+		return nil
+	}
+	return &geo
+}
+
+func stringValue(value interface{}) string {
+	str, _ := value.(string)
+	return strings.TrimSpace(str)
+}
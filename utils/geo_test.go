@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractGeoConflictRules(t *testing.T) {
+	bestMatch := map[string]interface{}{
+		"country":  "US",
+		"region":   "PA",
+		"city":     "Philadelphia",
+		"zipCodes": "19125,19123",
+	}
+
+	tests := []struct {
+		name                    string
+		countryCode, regionCode string
+		want                    *GeoContext
+	}{
+		{"lookup only", "", "", &GeoContext{CountryCode: "US", RegionCode: "PA", City: "Philadelphia", PostalCode: "19125"}},
+		{"user region wins", "us", "NJ", &GeoContext{CountryCode: "US", RegionCode: "NJ", City: "Philadelphia", PostalCode: "19125"}},
+		{"user market in another country", "GB", "", &GeoContext{CountryCode: "GB"}},
+	}
+	for _, tt := range tests {
+		if got := extractGeo(bestMatch, tt.countryCode, tt.regionCode); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := extractGeo(nil, "", ""); got != nil {
+		t.Errorf("no geo: got %+v, want nil", got)
+	}
+}
+
+func TestGeoFillsUOBestMatch(t *testing.T) {
+	commonRequest := &CommonRequestFormat{
+		Geo: &GeoContext{CountryCode: "CA", RegionCode: "ON", City: "Toronto"},
+	}
+
+	uoRequest, err := (&CommonToUOTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"country": "CA", "region": "ON", "city": "Toronto"}
+	if !reflect.DeepEqual(uoRequest.BestMatch, want) {
+		t.Errorf("bestMatch = %v, want %v", uoRequest.BestMatch, want)
+	}
+	attributes := uoRequest.IsEvent.User.Attributes
+	if attributes.CountryCode != "CA" || attributes.RegionCode != "ON" {
+		t.Errorf("country/region = %s/%s, want CA/ON", attributes.CountryCode, attributes.RegionCode)
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "re-extract testdata fixtures and rewrite golden files")
+
+// Source documents the fixtures are extracted from
+const (
+	testPayloadsDoc    = "../work/requests/TEST_PAYLOADS.md"
+	isResponsesDoc     = "../work/responses/isResponses.json"
+	commonResponsesDoc = "../work/responses/CommonResponses.json"
+)
+
+var (
+	payloadHeading = regexp.MustCompile(`(?m)^### ([^\n]+)\n` + "```json\n")
+	nonSlugChars   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// goldenTime pins generated timestamps and session IDs
+var goldenTime = time.Date(2025, 1, 11, 12, 0, 0, 0, time.UTC)
+
+// TestGolden runs every registered translator pair over every fixture and compares the
+// output with testdata/golden/<kind>/<from>-to-<to>/<fixture>.json. Run with -update to
+// re-extract the fixtures from the work/ documents and rewrite the golden files.
+func TestGolden(t *testing.T) {
+	if *update {
+		extractFixtures(t)
+	}
+	pinClock(t)
+
+	registry := NewDefaultRegistry()
+	for _, kind := range []Kind{KindRequest, KindResponse} {
+		for _, from := range registry.Formats(kind) {
+			for _, fixture := range fixtures(t, kind, from) {
+				for _, to := range registry.Formats(kind) {
+					translator, err := registry.Lookup(kind, from, to)
+					if err != nil {
+						continue
+					}
+
+					name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+					golden := filepath.Join("testdata", "golden", string(kind), PairName(from, to), name+".json")
+					t.Run(fmt.Sprintf("%s/%s/%s", kind, PairName(from, to), name), func(t *testing.T) {
+						input := loadFixture(t, registry, kind, from, fixture)
+
+						var result interface{}
+						output, err := translator.Translate(context.Background(), input)
+						if err != nil {
+							result = map[string]string{"error": err.Error()}
+						} else {
+							result = output
+						}
+
+						got, err := json.MarshalIndent(result, "", "  ")
+						if err != nil {
+							t.Fatalf("marshal output: %v", err)
+						}
+						got = append(got, '\n')
+
+						if *update {
+							writeFile(t, golden, got)
+							return
+						}
+
+						want, err := os.ReadFile(golden)
+						if err != nil {
+							t.Fatalf("read golden file (run with -update to create it): %v", err)
+						}
+						if !bytes.Equal(got, want) {
+							var wantValue interface{}
+							json.Unmarshal(want, &wantValue)
+							differences, _ := DiffJSON(wantValue, result)
+							t.Errorf("output differs from %s (run with -update and review the diff):\n%s", golden, formatDifferences(differences))
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestRoundTripFidelity checks that formats with a lossless Common mapping survive a round trip
+func TestRoundTripFidelity(t *testing.T) {
+	pinClock(t)
+
+	registry := NewDefaultRegistry()
+	for _, format := range []struct {
+		kind Kind
+		name string
+	}{
+		{KindRequest, FormatUO},
+		{KindRequest, FormatDY},
+		{KindRequest, FormatDYEvent},
+		{KindRequest, FormatDYEngagement},
+		{KindResponse, FormatIS},
+	} {
+		for _, fixture := range fixtures(t, format.kind, format.name) {
+			t.Run(fmt.Sprintf("%s/%s/%s", format.kind, format.name, filepath.Base(fixture)), func(t *testing.T) {
+				data, err := os.ReadFile(fixture)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				report, err := registry.VerifyRoundTrip(context.Background(), format.kind, format.name, data)
+				if err != nil {
+					t.Fatalf("round trip: %v", err)
+				}
+				if !report.Equal {
+					t.Errorf("round trip is lossy:\n%s", formatDifferences(report.Differences))
+				}
+			})
+		}
+	}
+}
+
+func pinClock(t *testing.T) {
+	previous := now
+	now = func() time.Time { return goldenTime }
+	t.Cleanup(func() { now = previous })
+}
+
+func fixtures(t *testing.T, kind Kind, format string) []string {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fixtures", string(kind), format, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func loadFixture(t *testing.T, registry *Registry, kind Kind, format, path string) interface{} {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := registry.NewPayload(kind, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, input); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return input
+}
+
+func formatDifferences(differences []Difference) string {
+	var b strings.Builder
+	for _, difference := range differences {
+		fmt.Fprintf(&b, "  %s %s: %v -> %v\n", difference.Op, difference.Path, difference.Before, difference.After)
+	}
+	return b.String()
+}
+
+// extractFixtures rebuilds testdata/fixtures from the payload documents under work/
+func extractFixtures(t *testing.T) {
+	doc, err := os.ReadFile(testPayloadsDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := payloadHeading.FindAllSubmatchIndex(doc, -1)
+	for _, match := range matches {
+		title := string(doc[match[2]:match[3]])
+
+		// Only the first JSON value of each block is kept: some blocks carry a stray
+		// closing brace and the last block is not fenced
+		var payload json.RawMessage
+		if err := json.NewDecoder(bytes.NewReader(doc[match[1]:])).Decode(&payload); err != nil {
+			t.Fatalf("payload %q: %v", title, err)
+		}
+
+		var probe map[string]interface{}
+		json.Unmarshal(payload, &probe)
+		format := FormatDY
+		if _, isUO := probe["isEvent"]; isUO {
+			format = FormatUO
+		}
+
+		name := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+		writeFixture(t, KindRequest, format, name, payload)
+	}
+
+	for _, source := range []struct {
+		path   string
+		format string
+	}{
+		{isResponsesDoc, FormatIS},
+		{commonResponsesDoc, FormatCommon},
+	} {
+		data, err := os.ReadFile(source.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var responses []json.RawMessage
+		if err := json.Unmarshal(data, &responses); err != nil {
+			t.Fatalf("%s: %v", source.path, err)
+		}
+		for i, response := range responses {
+			writeFixture(t, KindResponse, source.format, fmt.Sprintf("%s-response-%02d", source.format, i+1), response)
+		}
+	}
+}
+
+func writeFixture(t *testing.T, kind Kind, format, name string, payload json.RawMessage) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, payload, "", "  "); err != nil {
+		t.Fatalf("fixture %s: %v", name, err)
+	}
+	indented.WriteByte('\n')
+	writeFile(t, filepath.Join("testdata", "fixtures", string(kind), format, name+".json"), indented.Bytes())
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,419 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Identifier types
+const (
+	IdentifierAnonymous = "anonymous" // A visitor not known to be a customer
+	IdentifierCustomer  = "customer"  // The brand's customer account
+	IdentifierVendor    = "vendor"    // A personalization vendor's own user ID
+)
+
+// Identifier namespaces
+const (
+	NamespaceUO       = "uo"        // isEvent.user.id
+	NamespaceCustomer = "customer"  // isEvent.user.attributes.customerId, DY cuid of type "id"
+	NamespaceDY       = "dy"        // DY user.dyid
+	NamespaceDYServer = "dy_server" // DY user.dyid_server
+)
+
+// Identifier types per namespace
+var namespaceTypes = map[string]string{
+	NamespaceUO:       IdentifierAnonymous,
+	NamespaceCustomer: IdentifierCustomer,
+	NamespaceDY:       IdentifierVendor,
+	NamespaceDYServer: IdentifierVendor,
+}
+
+// dyCUIDTypeCustomerID is the DY cuidType of customer IDs
+const dyCUIDTypeCustomerID = "id"
+
+// Identifier - One ID of a user, within the namespace that issued it
+type Identifier struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Value     string `json:"value"`
+}
+
+// IdentityContext - Every known ID of the user, from the payload or linked in the
+// identity store
+type IdentityContext struct {
+	Identifiers []Identifier `json:"identifiers"`
+}
+
+// Value returns the ID in the namespace, or "" when the user has none
+func (c *IdentityContext) Value(namespace string) string {
+	if c == nil {
+		return ""
+	}
+	for _, identifier := range c.Identifiers {
+		if identifier.Namespace == namespace {
+			return identifier.Value
+		}
+	}
+	return ""
+}
+
+// IdentityStore - Links the IDs of a user across namespaces, so a translation can supply
+// IDs its source format does not carry
+type IdentityStore interface {
+	// Link records that the identifiers belong to one user
+	Link(identifiers []Identifier) error
+	// Linked returns every identifier linked to the given one, itself included
+	Linked(identifier Identifier) ([]Identifier, error)
+}
+
+var activeIdentityStore atomic.Pointer[IdentityStore]
+
+// SetIdentityStore installs the store translations link and look up IDs in; nil removes it
+func SetIdentityStore(store IdentityStore) {
+	if store == nil {
+		activeIdentityStore.Store(nil)
+		return
+	}
+	activeIdentityStore.Store(&store)
+}
+
+// newIdentifier returns the identifier for a namespace, or false for an empty value
+func newIdentifier(namespace, value string) (Identifier, bool) {
+	if value == "" {
+		return Identifier{}, false
+	}
+	return Identifier{Type: namespaceTypes[namespace], Namespace: namespace, Value: value}, true
+}
+
+// resolveIdentity builds the identity section from the payload's identifiers, keyed by
+// namespace. With an identity store installed and the user's consent, the identifiers
+// are linked and the IDs already linked to them added; without consent, the store is
+// neither written nor read. The store is best effort: when it fails, the payload's
+// identifiers stand alone.
+func resolveIdentity(values map[string]string, consented bool) *IdentityContext {
+	var identifiers []Identifier
+	for namespace, value := range values {
+		if identifier, ok := newIdentifier(namespace, value); ok {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	if len(identifiers) == 0 {
+		return nil
+	}
+
+	if store := activeIdentityStore.Load(); store != nil && consented {
+		if len(identifiers) > 1 {
+			(*store).Link(identifiers)
+		}
+		identifiers = withLinked(*store, identifiers)
+	}
+
+	sortIdentifiers(identifiers)
+	return &IdentityContext{Identifiers: identifiers}
+}
+
+func withLinked(store IdentityStore, identifiers []Identifier) []Identifier {
+	seen := map[Identifier]bool{}
+	for _, identifier := range identifiers {
+		seen[identifier] = true
+	}
+	for _, identifier := range identifiers {
+		linked, err := store.Linked(identifier)
+		if err != nil {
+			continue
+		}
+		for _, candidate := range linked {
+			if !seen[candidate] {
+				seen[candidate] = true
+				identifiers = append(identifiers, candidate)
+			}
+		}
+	}
+	return identifiers
+}
+
+func sortIdentifiers(identifiers []Identifier) {
+	sort.Slice(identifiers, func(i, j int) bool {
+		if identifiers[i].Namespace != identifiers[j].Namespace {
+			return identifiers[i].Namespace < identifiers[j].Namespace
+		}
+		return identifiers[i].Value < identifiers[j].Value
+	})
+}
+
+// DefaultIdentityStoreLimit is the number of identifiers an identity store holds by default
+const DefaultIdentityStoreLimit = 100000
+
+// identityGroup - Identifiers linked to one user
+type identityGroup struct {
+	members []Identifier
+	element *list.Element // The group's place in the recency list
+}
+
+// MemoryIdentityStore - An IdentityStore held in process memory. It holds at most limit
+// identifiers: beyond that, the groups linked least recently are forgotten.
+type MemoryIdentityStore struct {
+	limit int
+
+	mu      sync.RWMutex
+	groups  map[Identifier]*identityGroup
+	recency *list.List // Groups, least recently linked first
+}
+
+// NewMemoryIdentityStore returns an empty in-memory identity store holding at most limit
+// identifiers; a limit of 0 leaves it unbounded
+func NewMemoryIdentityStore(limit int) *MemoryIdentityStore {
+	return &MemoryIdentityStore{
+		limit:   limit,
+		groups:  make(map[Identifier]*identityGroup),
+		recency: list.New(),
+	}
+}
+
+// Link merges the groups of the identifiers into one
+func (s *MemoryIdentityStore) Link(identifiers []Identifier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.link(identifiers)
+	return nil
+}
+
+// changes reports whether linking the identifiers would change the store
+func (s *MemoryIdentityStore) changes(identifiers []Identifier) bool {
+	if len(identifiers) == 0 {
+		return false
+	}
+	first := s.groups[identifiers[0]]
+	if first == nil {
+		return true
+	}
+	for _, identifier := range identifiers[1:] {
+		if s.groups[identifier] != first {
+			return true
+		}
+	}
+	return false
+}
+
+// link merges the groups and reports whether that changed the store
+func (s *MemoryIdentityStore) link(identifiers []Identifier) bool {
+	if !s.changes(identifiers) {
+		return false
+	}
+
+	members := map[Identifier]bool{}
+	for _, identifier := range identifiers {
+		members[identifier] = true
+		if group, exists := s.groups[identifier]; exists && group.element != nil {
+			for _, member := range group.members {
+				members[member] = true
+			}
+			s.recency.Remove(group.element)
+			group.element = nil
+		}
+	}
+
+	merged := &identityGroup{members: make([]Identifier, 0, len(members))}
+	for member := range members {
+		merged.members = append(merged.members, member)
+	}
+	sortIdentifiers(merged.members)
+	merged.element = s.recency.PushBack(merged)
+	for _, member := range merged.members {
+		s.groups[member] = merged
+	}
+
+	s.evict()
+	return true
+}
+
+// evict forgets the least recently linked groups until the store is within its limit,
+// always keeping the newest group
+func (s *MemoryIdentityStore) evict() {
+	for s.limit > 0 && len(s.groups) > s.limit && s.recency.Len() > 1 {
+		oldest := s.recency.Remove(s.recency.Front()).(*identityGroup)
+		for _, member := range oldest.members {
+			delete(s.groups, member)
+		}
+	}
+}
+
+// Linked returns the group of the identifier
+func (s *MemoryIdentityStore) Linked(identifier Identifier) ([]Identifier, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	group, exists := s.groups[identifier]
+	if !exists {
+		return []Identifier{identifier}, nil
+	}
+	return append([]Identifier(nil), group.members...), nil
+}
+
+// snapshot returns every group once, least recently linked first
+func (s *MemoryIdentityStore) snapshot() [][]Identifier {
+	groups := make([][]Identifier, 0, s.recency.Len())
+	for element := s.recency.Front(); element != nil; element = element.Next() {
+		groups = append(groups, element.Value.(*identityGroup).members)
+	}
+	return groups
+}
+
+// identityLogSlack is the number of log entries beyond twice the live groups that a file
+// identity store tolerates before compacting its log
+const identityLogSlack = 1024
+
+// FileIdentityStore - An in-memory identity store persisted to an append-only log: one
+// JSON line per link that changed the store, replayed on start. Suited to single-instance
+// deployments. The store keeps the limit of the memory store, and the log is compacted to
+// one line per live group once it holds more than twice as many lines plus a slack, so
+// both memory and the file stay bounded and each link costs one append.
+type FileIdentityStore struct {
+	*MemoryIdentityStore
+	path    string
+	log     *os.File
+	entries int // Lines in the log
+}
+
+// NewFileIdentityStore loads the store from the log at path, starting empty if the file
+// does not exist yet, and holds at most limit identifiers
+func NewFileIdentityStore(path string, limit int) (*FileIdentityStore, error) {
+	store := &FileIdentityStore{MemoryIdentityStore: NewMemoryIdentityStore(limit), path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var group []Identifier
+		if err := json.Unmarshal(scanner.Bytes(), &group); err != nil {
+			return nil, fmt.Errorf("parsing %s line %d: %w", path, line, err)
+		}
+		store.link(group)
+		store.entries++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if store.needsCompaction() {
+		if err := store.compact(); err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if err := store.openLog(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Link appends the identifiers to the log and, once they are on it, merges their groups.
+// Links that would not change the store are not written. A link stands even when
+// compacting the log afterwards fails.
+func (s *FileIdentityStore) Link(identifiers []Identifier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.changes(identifiers) {
+		return nil
+	}
+
+	line, err := json.Marshal(identifiers)
+	if err != nil {
+		return err
+	}
+	// A failed compaction may have left the log closed
+	if s.log == nil {
+		if err := s.openLog(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.link(identifiers)
+	s.entries++
+
+	if s.needsCompaction() {
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("compacting %s: %w", s.path, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the log
+func (s *FileIdentityStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	return s.log.Close()
+}
+
+// openLog opens the log for appending, creating it if need be
+func (s *FileIdentityStore) openLog() (err error) {
+	s.log, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	return err
+}
+
+func (s *FileIdentityStore) needsCompaction() bool {
+	return s.entries > 2*s.recency.Len()+identityLogSlack
+}
+
+// compact rewrites the log as one line per live group. Until the new log replaces it, the
+// old one stays open; once it has, the old handle is closed even if the new log cannot
+// be opened, and the next link opens it.
+func (s *FileIdentityStore) compact() error {
+	var data bytes.Buffer
+	groups := s.snapshot()
+	for _, group := range groups {
+		line, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	// Write a temporary file and rename it so readers never see a partial log
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data.Bytes()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// The old handle refers to the replaced log: appending to it would lose the links
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+	s.entries = len(groups)
+	return s.openLog()
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIdentityStoreSuppliesDYIDForKnownCustomer(t *testing.T) {
+	SetIdentityStore(NewMemoryIdentityStore(DefaultIdentityStoreLimit))
+	t.Cleanup(func() { SetIdentityStore(nil) })
+
+	// A DY login links the DY user to the customer
+	login := &DYEventRequest{
+		User: DYUser{Dyid: "dy-1", DyidServer: "dy-1", ActiveConsentAccepted: true},
+		Events: []DYEvent{{Name: "Login", Properties: DYEventProperties{
+			DYType: DYEventTypeLogin, CUID: "customer-1", CUIDType: "id",
+		}}},
+	}
+	if _, err := (&DYEventToCommonTranslator{}).Translate(login); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later UO request of the customer reaches DY with the DY user ID
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			Action: "Page View",
+			User:   IsEventUser{ID: "visitor-1", Attributes: IsEventUserAttributes{CustomerID: "customer-1"}},
+		},
+	}
+	common, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dyRequest, err := (&CommonToDYRequestTranslator{}).Translate(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dyRequest.User.Dyid != "dy-1" || dyRequest.User.DyidServer != "dy-1" {
+		t.Errorf("DY user = %+v, want dyid and dyid_server dy-1", dyRequest.User)
+	}
+}
+
+func TestFileIdentityStorePersistsLinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	store, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customer, _ := newIdentifier(NamespaceCustomer, "customer-1")
+	visitor, _ := newIdentifier(NamespaceUO, "visitor-1")
+	dyUser, _ := newIdentifier(NamespaceDY, "dy-1")
+	if err := store.Link([]Identifier{customer, visitor}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Link([]Identifier{customer, dyUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Close()
+
+	reloaded, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := reloaded.Linked(visitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Identifier{customer, dyUser, visitor}
+	if !reflect.DeepEqual(linked, want) {
+		t.Errorf("linked = %+v, want %+v", linked, want)
+	}
+}
+
+func TestFileIdentityStoreAppendsAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.jsonl")
+	store, err := NewFileIdentityStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	customer, _ := newIdentifier(NamespaceCustomer, "customer-1")
+	visitor, _ := newIdentifier(NamespaceUO, "visitor-1")
+	store.Link([]Identifier{customer, visitor})
+	store.Link([]Identifier{visitor, customer}) // Already linked: nothing to write
+	if lines := logLines(t, path); lines != 1 {
+		t.Errorf("log has %d lines after one change, want 1", lines)
+	}
+
+	// With room for one group, every new link evicts the last; the log of the evicted
+	// links is compacted away
+	for i := 0; i < 2*identityLogSlack; i++ {
+		customer, _ := newIdentifier(NamespaceCustomer, fmt.Sprintf("customer-%d", i))
+		visitor, _ := newIdentifier(NamespaceUO, fmt.Sprintf("visitor-%d", i))
+		store.Link([]Identifier{customer, visitor})
+	}
+	if lines := logLines(t, path); lines > 2+identityLogSlack {
+		t.Errorf("log has %d lines for one group, want it compacted", lines)
+	}
+
+	store.Close()
+	reloaded, err := NewFileIdentityStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	last, _ := newIdentifier(NamespaceUO, fmt.Sprintf("visitor-%d", 2*identityLogSlack-1))
+	if linked, _ := reloaded.Linked(last); len(linked) != 2 {
+		t.Errorf("last group after reload = %+v, want two identifiers", linked)
+	}
+}
+
+func TestIdentityStoreLimit(t *testing.T) {
+	store := NewMemoryIdentityStore(4)
+	for _, value := range []string{"a", "b", "c"} {
+		customer, _ := newIdentifier(NamespaceCustomer, "customer-"+value)
+		visitor, _ := newIdentifier(NamespaceUO, "visitor-"+value)
+		store.Link([]Identifier{customer, visitor})
+	}
+
+	// The oldest group was forgotten to stay within four identifiers
+	oldest, _ := newIdentifier(NamespaceUO, "visitor-a")
+	if linked, _ := store.Linked(oldest); len(linked) != 1 {
+		t.Errorf("oldest group still linked: %+v", linked)
+	}
+	newest, _ := newIdentifier(NamespaceUO, "visitor-c")
+	if linked, _ := store.Linked(newest); len(linked) != 2 {
+		t.Errorf("newest group = %+v, want two identifiers", linked)
+	}
+}
+
+func logLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestFileIdentityStoreFailedAppendLeavesStoreUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.jsonl")
+	store, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// A read-only handle fails appends whatever the user's permissions
+	store.log.Close()
+	if store.log, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	customer, _ := newIdentifier(NamespaceCustomer, "customer-1")
+	visitor, _ := newIdentifier(NamespaceUO, "visitor-1")
+	if err := store.Link([]Identifier{customer, visitor}); err == nil {
+		t.Fatal("link succeeded without being written")
+	}
+	if linked, _ := store.Linked(visitor); len(linked) != 1 {
+		t.Errorf("unwritten link applied: %+v", linked)
+	}
+
+	// Once the log can be written again, the link is written and applied
+	store.log.Close()
+	store.log = nil
+	if err := store.Link([]Identifier{customer, visitor}); err != nil {
+		t.Fatal(err)
+	}
+	if linked, _ := store.Linked(visitor); len(linked) != 2 {
+		t.Errorf("linked = %+v, want both identifiers", linked)
+	}
+	if lines := logLines(t, path); lines != 1 {
+		t.Errorf("log has %d lines, want 1", lines)
+	}
+}
+
+func TestFileIdentityStoreSurvivesFailedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "identities.jsonl")
+	store, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0o755)
+	if probe, err := os.CreateTemp(dir, "probe"); err == nil {
+		probe.Close()
+		t.Skip("directory permissions are not enforced for this user")
+	}
+
+	// The next link is due a compaction, which cannot write its file
+	store.entries = 2*identityLogSlack + 1
+	customer, _ := newIdentifier(NamespaceCustomer, "customer-1")
+	visitor, _ := newIdentifier(NamespaceUO, "visitor-1")
+	if err := store.Link([]Identifier{customer, visitor}); err == nil || !strings.Contains(err.Error(), "compacting") {
+		t.Errorf("error = %v, want a compaction failure", err)
+	}
+	if linked, _ := store.Linked(visitor); len(linked) != 2 {
+		t.Errorf("written link not applied: %+v", linked)
+	}
+
+	// Links keep being written, and compacted once the directory is writable again
+	dyUser, _ := newIdentifier(NamespaceDY, "dy-1")
+	if err := store.Link([]Identifier{customer, dyUser}); err == nil {
+		t.Error("compaction succeeded in a read-only directory")
+	}
+	if lines := logLines(t, path); lines != 2 {
+		t.Errorf("log has %d lines, want both links", lines)
+	}
+	os.Chmod(dir, 0o755)
+	other, _ := newIdentifier(NamespaceUO, "visitor-2")
+	if err := store.Link([]Identifier{other, customer}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := logLines(t, path); lines != 1 {
+		t.Errorf("log has %d lines after compaction, want one group", lines)
+	}
+
+	store.Close()
+	reloaded, err := NewFileIdentityStore(path, DefaultIdentityStoreLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if linked, _ := reloaded.Linked(other); len(linked) != 4 {
+		t.Errorf("linked after reload = %+v, want all four identifiers", linked)
+	}
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Difference operations
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// Difference - A single JSON-path difference between two documents
+type Difference struct {
+	Path       string      `json:"path"`
+	Op         string      `json:"op"`
+	Before     interface{} `json:"before,omitempty"`
+	After      interface{} `json:"after,omitempty"`
+	BeforeType string      `json:"beforeType,omitempty"`
+	AfterType  string      `json:"afterType,omitempty"`
+}
+
+// RoundTripReport - Result of translating a payload to Common and back
+type RoundTripReport struct {
+	Kind        Kind         `json:"kind"`
+	Format      string       `json:"format"`
+	Equal       bool         `json:"equal"`
+	Differences []Difference `json:"differences"`
+	Common      interface{}  `json:"common"`
+	Result      interface{}  `json:"result"`
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// DiffJSON compares two values by their JSON representation and returns the differences
+// in path order. Paths use JSON-path notation rooted at "$".
+func DiffJSON(before, after interface{}) ([]Difference, error) {
+	var normalizedBefore, normalizedAfter interface{}
+	if err := remarshal(before, &normalizedBefore); err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	if err := remarshal(after, &normalizedAfter); err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+
+	differences := []Difference{}
+	diffValues("$", normalizedBefore, normalizedAfter, &differences)
+	return differences, nil
+}
+
+func diffValues(path string, before, after interface{}, differences *[]Difference) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		diffObjects(path, beforeMap, afterMap, differences)
+		return
+	}
+
+	beforeSlice, beforeIsSlice := before.([]interface{})
+	afterSlice, afterIsSlice := after.([]interface{})
+	if beforeIsSlice && afterIsSlice {
+		diffArrays(path, beforeSlice, afterSlice, differences)
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*differences = append(*differences, Difference{
+			Path:       path,
+			Op:         DiffChanged,
+			Before:     before,
+			After:      after,
+			BeforeType: jsonType(before),
+			AfterType:  jsonType(after),
+		})
+	}
+}
+
+func diffObjects(path string, before, after map[string]interface{}, differences *[]Difference) {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, exists := before[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := objectPath(path, key)
+		beforeValue, inBefore := before[key]
+		afterValue, inAfter := after[key]
+
+		switch {
+		case !inBefore:
+			*differences = append(*differences, Difference{Path: childPath, Op: DiffAdded, After: afterValue, AfterType: jsonType(afterValue)})
+		case !inAfter:
+			*differences = append(*differences, Difference{Path: childPath, Op: DiffRemoved, Before: beforeValue, BeforeType: jsonType(beforeValue)})
+		default:
+			diffValues(childPath, beforeValue, afterValue, differences)
+		}
+	}
+}
+
+func diffArrays(path string, before, after []interface{}, differences *[]Difference) {
+	for i := 0; i < len(before) || i < len(after); i++ {
+		childPath := path + "[" + strconv.Itoa(i) + "]"
+
+		switch {
+		case i >= len(before):
+			*differences = append(*differences, Difference{Path: childPath, Op: DiffAdded, After: after[i], AfterType: jsonType(after[i])})
+		case i >= len(after):
+			*differences = append(*differences, Difference{Path: childPath, Op: DiffRemoved, Before: before[i], BeforeType: jsonType(before[i])})
+		default:
+			diffValues(childPath, before[i], after[i], differences)
+		}
+	}
+}
+
+func objectPath(path, key string) string {
+	if identifierPattern.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// VerifyRoundTrip translates a JSON payload of the given format to Common and back, and
+// reports every difference between the payload as sent and the result. The diff starts
+// from the raw document rather than the decoded payload, so fields the format's structs
+// do not model show up as removed.
+func (r *Registry) VerifyRoundTrip(ctx context.Context, kind Kind, format string, body []byte) (*RoundTripReport, error) {
+	toCommon, err := r.Lookup(kind, format, FormatCommon)
+	if err != nil {
+		return nil, err
+	}
+	fromCommon, err := r.Lookup(kind, FormatCommon, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	input, err := r.NewPayload(kind, format)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, input); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	common, err := toCommon.Translate(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("to common: %w", err)
+	}
+
+	// Pass Common through JSON so the reverse leg sees what an HTTP caller would send
+	commonPayload, err := r.NewPayload(kind, FormatCommon)
+	if err != nil {
+		return nil, err
+	}
+	if err := remarshal(common, commonPayload); err != nil {
+		return nil, fmt.Errorf("common payload: %w", err)
+	}
+
+	result, err := fromCommon.Translate(ctx, commonPayload)
+	if err != nil {
+		return nil, fmt.Errorf("from common: %w", err)
+	}
+
+	differences, err := DiffJSON(raw, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RoundTripReport{
+		Kind:        kind,
+		Format:      format,
+		Equal:       len(differences) == 0,
+		Differences: differences,
+		Common:      common,
+		Result:      result,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRoundTripReportsUnmodeledFields(t *testing.T) {
+	pinClock(t)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "fixtures", "request", "dy", "dy-1-homepage-request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewDefaultRegistry()
+	report, err := registry.VerifyRoundTrip(context.Background(), KindRequest, FormatDY, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Equal {
+		t.Fatalf("fixture round trip is lossy:\n%s", formatDifferences(report.Differences))
+	}
+
+	// A key the DY structs do not model is dropped on decode; the report must show it
+	withUnmodeled := append([]byte(`{"experimentVariant": "b",`), data[1:]...)
+	report, err = registry.VerifyRoundTrip(context.Background(), KindRequest, FormatDY, withUnmodeled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Difference{Path: "$.experimentVariant", Op: DiffRemoved, Before: "b", BeforeType: "string"}
+	if report.Equal || len(report.Differences) != 1 || report.Differences[0] != want {
+		t.Errorf("differences = %+v, want only %+v", report.Differences, want)
+	}
+}
@@ -0,0 +1,339 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// Violation - A single schema violation located by JSON pointer
+type Violation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// Schema - The subset of JSON Schema draft-07 used by the translator schemas:
+// $ref to local definitions, type, enum, const, properties, required,
+// additionalProperties, items, anyOf, min/max bounds and pattern.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+
+	// Set for the boolean schemas true and false
+	boolean *bool
+	pattern *regexp.Regexp
+	root    *Schema
+}
+
+// schemaTypes accepts both "type": "string" and "type": ["string", "null"]
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if string(trimmed) == "true" || string(trimmed) == "false" {
+		value := string(trimmed) == "true"
+		s.boolean = &value
+		return nil
+	}
+
+	// Alias drops the method set to avoid recursing into UnmarshalJSON
+	type schemaAlias Schema
+	return json.Unmarshal(data, (*schemaAlias)(s))
+}
+
+// ParseSchema parses a JSON Schema document and resolves its patterns
+func ParseSchema(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := schema.compile(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (s *Schema) compile(root *Schema) error {
+	if s == nil {
+		return nil
+	}
+	s.root = root
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+
+	children := []*Schema{s.AdditionalProperties, s.Items}
+	children = append(children, s.AnyOf...)
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if err := child.compile(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates a decoded JSON value (as produced by encoding/json into interface{})
+func (s *Schema) Validate(value interface{}) []Violation {
+	violations := []Violation{}
+	s.validate("", value, &violations)
+	return violations
+}
+
+func (s *Schema) validate(pointer string, value interface{}, violations *[]Violation) {
+	if s.boolean != nil {
+		if !*s.boolean {
+			addViolation(violations, pointer, "value is not allowed")
+		}
+		return
+	}
+
+	if s.Ref != "" {
+		target, err := s.resolve(s.Ref)
+		if err != nil {
+			addViolation(violations, pointer, err.Error())
+			return
+		}
+		target.validate(pointer, value, violations)
+		return
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		addViolation(violations, pointer, fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), jsonType(value)))
+		return
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		addViolation(violations, pointer, fmt.Sprintf("value %v is not one of %v", value, s.Enum))
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.Const, value) {
+		addViolation(violations, pointer, fmt.Sprintf("value %v does not equal %v", value, s.Const))
+	}
+
+	if len(s.AnyOf) > 0 && !s.matchesAnyOf(pointer, value) {
+		addViolation(violations, pointer, "value does not match any allowed schema")
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(pointer, typed, violations)
+	case []interface{}:
+		s.validateArray(pointer, typed, violations)
+	case string:
+		if s.MinLength != nil && len([]rune(typed)) < *s.MinLength {
+			addViolation(violations, pointer, fmt.Sprintf("string shorter than %d characters", *s.MinLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			addViolation(violations, pointer, fmt.Sprintf("string does not match pattern %q", s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && typed < *s.Minimum {
+			addViolation(violations, pointer, fmt.Sprintf("value %v is less than minimum %v", typed, *s.Minimum))
+		}
+		if s.Maximum != nil && typed > *s.Maximum {
+			addViolation(violations, pointer, fmt.Sprintf("value %v is greater than maximum %v", typed, *s.Maximum))
+		}
+	}
+}
+
+func (s *Schema) validateObject(pointer string, object map[string]interface{}, violations *[]Violation) {
+	for _, name := range s.Required {
+		if _, exists := object[name]; !exists {
+			addViolation(violations, pointerTo(pointer, name), "required property is missing")
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, exists := s.Properties[name]; exists {
+			property.validate(pointerTo(pointer, name), object[name], violations)
+		} else if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(pointerTo(pointer, name), object[name], violations)
+		}
+	}
+}
+
+func (s *Schema) validateArray(pointer string, array []interface{}, violations *[]Violation) {
+	if s.MinItems != nil && len(array) < *s.MinItems {
+		addViolation(violations, pointer, fmt.Sprintf("array has fewer than %d items", *s.MinItems))
+	}
+	if s.Items == nil {
+		return
+	}
+	for i, item := range array {
+		s.Items.validate(pointer+"/"+strconv.Itoa(i), item, violations)
+	}
+}
+
+func (s *Schema) matchesType(value interface{}) bool {
+	actual := jsonType(value)
+	for _, expected := range s.Type {
+		if expected == actual {
+			return true
+		}
+		if expected == "integer" {
+			if number, ok := value.(float64); ok && number == math.Trunc(number) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Schema) matchesAnyOf(pointer string, value interface{}) bool {
+	for _, candidate := range s.AnyOf {
+		candidateViolations := []Violation{}
+		candidate.validate(pointer, value, &candidateViolations)
+		if len(candidateViolations) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/definitions/")
+	if !ok || s.root == nil {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	target, exists := s.root.Definitions[name]
+	if !exists {
+		return nil, fmt.Errorf("unresolved $ref %q", ref)
+	}
+	return target, nil
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func addViolation(violations *[]Violation, pointer, message string) {
+	if pointer == "" {
+		pointer = "/"
+	}
+	*violations = append(*violations, Violation{Pointer: pointer, Message: message})
+}
+
+// pointerTo appends an escaped reference token to a JSON pointer
+func pointerTo(pointer, name string) string {
+	name = strings.ReplaceAll(name, "~", "~0")
+	name = strings.ReplaceAll(name, "/", "~1")
+	return pointer + "/" + name
+}
+
+// SchemaRegistry - JSON Schemas keyed by kind and format name
+type SchemaRegistry struct {
+	schemas map[formatKey]*Schema
+}
+
+// NewSchemaRegistry returns an empty schema registry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[formatKey]*Schema)}
+}
+
+// NewDefaultSchemaRegistry returns a schema registry with the embedded built-in schemas,
+// named schemas/<kind>-<format>.json
+func NewDefaultSchemaRegistry() (*SchemaRegistry, error) {
+	r := NewSchemaRegistry()
+
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		kind, format, ok := strings.Cut(name, "-")
+		if !ok {
+			return nil, fmt.Errorf("schema file %s is not named <kind>-<format>.json", entry.Name())
+		}
+
+		data, err := schemaFiles.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		schema, err := ParseSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		r.Register(Kind(kind), format, schema)
+	}
+
+	return r, nil
+}
+
+// Register registers the schema for a format, replacing any existing one
+func (r *SchemaRegistry) Register(kind Kind, format string, schema *Schema) {
+	r.schemas[formatKey{kind: kind, name: format}] = schema
+}
+
+// Validate validates a payload against the schema registered for its format. Payloads of
+// formats without a schema are accepted. Typed payloads are validated by their JSON form.
+func (r *SchemaRegistry) Validate(kind Kind, format string, payload interface{}) ([]Violation, error) {
+	schema, exists := r.schemas[formatKey{kind: kind, name: format}]
+	if !exists {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := remarshal(payload, &value); err != nil {
+		return nil, err
+	}
+	return schema.Validate(value), nil
+}
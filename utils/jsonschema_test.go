@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validateJSON parses a schema and validates a JSON document against it
+func validateJSON(t *testing.T, schema, document string) []Violation {
+	t.Helper()
+	parsed, err := ParseSchema([]byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Validate(value)
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		schema   string
+		document string
+		want     []Violation // nil when the document is valid
+	}{
+		{"type match", `{"type": "string"}`, `"a"`, nil},
+		{"type mismatch", `{"type": "string"}`, `1`, []Violation{{"/", "expected string, got number"}}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"integer", `{"type": "integer"}`, `3`, nil},
+		{"integer fraction", `{"type": "integer"}`, `3.5`, []Violation{{"/", "expected integer, got number"}}},
+
+		{"required present", `{"required": ["a"]}`, `{"a": 1}`, nil},
+		{"required missing", `{"required": ["a", "b"]}`, `{"a": 1}`, []Violation{{"/b", "required property is missing"}}},
+
+		{"enum member", `{"enum": ["x", "y"]}`, `"y"`, nil},
+		{"enum non-member", `{"enum": ["x", "y"]}`, `"z"`, []Violation{{"/", "value z is not one of [x y]"}}},
+
+		{"items", `{"items": {"type": "number"}}`, `[1, "two", 3]`, []Violation{{"/1", "expected number, got string"}}},
+		{"items empty", `{"items": {"type": "number"}}`, `[]`, nil},
+
+		{
+			"properties",
+			`{"properties": {"a": {"type": "string"}, "b": {"type": "boolean"}}}`,
+			`{"a": 1, "b": true, "c": null}`,
+			[]Violation{{"/a", "expected string, got number"}},
+		},
+		{
+			"property pointer escaping",
+			`{"properties": {"a/b~c": {"type": "string"}}}`,
+			`{"a/b~c": 1}`,
+			[]Violation{{"/a~1b~0c", "expected string, got number"}},
+		},
+
+		{"additionalProperties false", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2}`, []Violation{{"/b", "value is not allowed"}}},
+		{"additionalProperties schema", `{"additionalProperties": {"type": "number"}}`, `{"a": 1, "b": "2"}`, []Violation{{"/b", "expected number, got string"}}},
+
+		{
+			"$ref",
+			`{"properties": {"a": {"$ref": "#/definitions/name"}}, "definitions": {"name": {"type": "string", "minLength": 1}}}`,
+			`{"a": ""}`,
+			[]Violation{{"/a", "string shorter than 1 characters"}},
+		},
+		{"$ref unresolved", `{"$ref": "#/definitions/missing"}`, `1`, []Violation{{"/", `unresolved $ref "#/definitions/missing"`}}},
+		{"$ref unsupported", `{"$ref": "other.json"}`, `1`, []Violation{{"/", `unsupported $ref "other.json"`}}},
+
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"required": ["a"]}]}`, `{"a": 1}`, nil},
+		{"anyOf none", `{"anyOf": [{"type": "string"}, {"required": ["a"]}]}`, `{}`, []Violation{{"/", "value does not match any allowed schema"}}},
+
+		{"const", `{"const": "dy"}`, `"is"`, []Violation{{"/", "value is does not equal dy"}}},
+		{"minItems", `{"minItems": 1}`, `[]`, []Violation{{"/", "array has fewer than 1 items"}}},
+		{"minimum", `{"minimum": 0}`, `-1`, []Violation{{"/", "value -1 is less than minimum 0"}}},
+		{"maximum", `{"maximum": 10}`, `11`, []Violation{{"/", "value 11 is greater than maximum 10"}}},
+		{"pattern", `{"pattern": "^[a-z]{2}$"}`, `"en-US"`, []Violation{{"/", `string does not match pattern "^[a-z]{2}$"`}}},
+		{"false schema", `{"properties": {"a": false}}`, `{"a": 1}`, []Violation{{"/a", "value is not allowed"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateJSON(t, test.schema, test.document)
+			if len(got) != len(test.want) {
+				t.Fatalf("violations = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("violation %d = %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSchemaRejectsInvalidPatterns(t *testing.T) {
+	if _, err := ParseSchema([]byte(`{"properties": {"a": {"pattern": "("}}}`)); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	if _, err := ParseSchema([]byte(`{"type": 1}`)); err == nil {
+		t.Error("invalid type accepted")
+	}
+}
+
+// sourceGaps are the schema violations of translations whose source lacks data the target
+// format requires, by pair and fixture: DY fixtures without user IDs have no UO user ID,
+// and engagements without a context have no page
+var sourceGaps = map[string][]string{
+	"request/dy-to-uo/dy-1-homepage-request":                           {"/isEvent/user/id"},
+	"request/dy-to-uo/dy-2-homepage-request-single-selector":           {"/isEvent/user/id"},
+	"request/dy-to-uo/dy-3-product-page-request":                       {"/isEvent/user/id"},
+	"request/dy-to-uo/dy-4-product-page-request-with-recsproductdata":  {"/isEvent/user/id"},
+	"request/dy-to-uo/dy-cart-page-request":                            {"/isEvent/user/id"},
+	"request/dy-to-uo/dy-category-page-request":                        {"/isEvent/user/id"},
+	"request/dy-engagement-to-common/dy-decision-impression-and-click": {"/page/type"},
+	"request/dy-engagement-to-uo/dy-decision-impression-and-click":     {"/isEvent/source/url"},
+}
+
+// TestFixturesConformToSchemas validates every fixture against the schema of its format,
+// and every translation of it against the schema of the target format
+func TestFixturesConformToSchemas(t *testing.T) {
+	pinClock(t)
+
+	schemas, err := NewDefaultSchemaRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewDefaultRegistry()
+	for _, kind := range []Kind{KindRequest, KindResponse} {
+		for _, from := range registry.Formats(kind) {
+			for _, fixture := range fixtures(t, kind, from) {
+				name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+				t.Run(fmt.Sprintf("%s/%s/%s", kind, from, name), func(t *testing.T) {
+					data, err := os.ReadFile(fixture)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var raw interface{}
+					if err := json.Unmarshal(data, &raw); err != nil {
+						t.Fatal(err)
+					}
+					violations, err := schemas.Validate(kind, from, raw)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(violations) > 0 {
+						t.Errorf("fixture violates the %s schema: %+v", from, violations)
+					}
+
+					input := loadFixture(t, registry, kind, from, fixture)
+					for _, to := range registry.Formats(kind) {
+						translator, err := registry.Lookup(kind, from, to)
+						if err != nil {
+							continue
+						}
+						output, err := translator.Translate(context.Background(), input)
+						if err != nil {
+							// Pairs that cannot translate a fixture are covered by the golden files
+							continue
+						}
+						violations, err := schemas.Validate(kind, to, output)
+						if err != nil {
+							t.Fatal(err)
+						}
+						var pointers []string
+						for _, violation := range violations {
+							pointers = append(pointers, violation.Pointer)
+						}
+						gaps := sourceGaps[fmt.Sprintf("%s/%s/%s", kind, PairName(from, to), name)]
+						if strings.Join(pointers, ",") != strings.Join(gaps, ",") {
+							t.Errorf("%s output violates the %s schema: %+v", PairName(from, to), to, violations)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"strings"
+)
+
+// Currencies of the regions the brands sell in, by ISO 3166 region code
+var regionCurrencies = map[string]string{
+	"US": "USD",
+	"CA": "CAD",
+	"GB": "GBP",
+	"AU": "AUD",
+	"NZ": "NZD",
+	"JP": "JPY",
+	"CH": "CHF",
+	"SE": "SEK",
+	"DK": "DKK",
+	"NO": "NOK",
+	"MX": "MXN",
+	"AT": "EUR",
+	"BE": "EUR",
+	"DE": "EUR",
+	"ES": "EUR",
+	"FI": "EUR",
+	"FR": "EUR",
+	"IE": "EUR",
+	"IT": "EUR",
+	"NL": "EUR",
+	"PT": "EUR",
+}
+
+// NormalizeLocale returns the BCP-47 form of a locale: separators become hyphens, the
+// language is lowercased, a script title-cased and a region uppercased, so "en_us"
+// becomes "en-US" and "zh_hant_tw" becomes "zh-Hant-TW". Malformed locales return "".
+func NormalizeLocale(locale string) string {
+	subtags := strings.FieldsFunc(strings.TrimSpace(locale), func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+	if len(subtags) == 0 || !isAlpha(subtags[0]) || len(subtags[0]) < 2 || len(subtags[0]) > 3 {
+		return ""
+	}
+
+	normalized := []string{strings.ToLower(subtags[0])}
+	for _, subtag := range subtags[1:] {
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag):
+			normalized = append(normalized, strings.ToUpper(subtag[:1])+strings.ToLower(subtag[1:]))
+		case len(subtag) == 2 && isAlpha(subtag), len(subtag) == 3 && isDigits(subtag):
+			normalized = append(normalized, strings.ToUpper(subtag))
+		default:
+			normalized = append(normalized, strings.ToLower(subtag))
+		}
+	}
+	return strings.Join(normalized, "-")
+}
+
+// uoLocale returns the underscore form UO and DY use for a locale, e.g. "en_US"
+func uoLocale(locale string) string {
+	return strings.ReplaceAll(NormalizeLocale(locale), "-", "_")
+}
+
+// localeLanguage returns the language subtag of a locale
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(NormalizeLocale(locale), "-")
+	return language
+}
+
+// localeRegion returns the region subtag of a locale, if it has one
+func localeRegion(locale string) string {
+	subtags := strings.Split(NormalizeLocale(locale), "-")
+	for _, subtag := range subtags[1:] {
+		if len(subtag) == 2 && isAlpha(subtag) {
+			return subtag
+		}
+	}
+	return ""
+}
+
+// currencyFor returns the currency of the locale's region, else the default currency
+func currencyFor(locale string, defaults *RequestDefaults) string {
+	if currency, exists := regionCurrencies[localeRegion(locale)]; exists {
+		return currency
+	}
+	return defaults.Currency
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
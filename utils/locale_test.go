@@ -0,0 +1,66 @@
+package utils
+
+import "testing"
+
+func TestNormalizeLocale(t *testing.T) {
+	for locale, want := range map[string]string{
+		"en_US":      "en-US",
+		"en-gb":      "en-GB",
+		"FR_fr":      "fr-FR",
+		"zh_hant_tw": "zh-Hant-TW",
+		"es-419":     "es-419",
+		"en":         "en",
+		"":           "",
+		"1_US":       "",
+	} {
+		if got := NormalizeLocale(locale); got != want {
+			t.Errorf("NormalizeLocale(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestLocaleRoundTripsThroughCommon(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			Action: "Page View",
+			Source: IsEventSource{Locale: "en_GB", URL: "https://www.urbanoutfitters.com/"},
+		},
+	}
+
+	common, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.Page.Locale != "en-GB" || common.Page.Language != "en" {
+		t.Errorf("locale/language = %s/%s, want en-GB/en", common.Page.Locale, common.Page.Language)
+	}
+
+	// Without extensions the locale is rebuilt in its UO form
+	common.Extensions = nil
+	back, err := (&CommonToUOTranslator{}).Translate(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.IsEvent.Source.Locale != "en_GB" {
+		t.Errorf("source locale = %q, want en_GB", back.IsEvent.Source.Locale)
+	}
+}
+
+func TestPurchaseCurrencyFollowsLocale(t *testing.T) {
+	commonRequest := &CommonRequestFormat{
+		Event: EventContext{Type: "purchase"},
+		Page:  PageContext{Locale: "fr-FR"},
+		Order: &OrderContext{ID: "order-1", Revenue: 120},
+	}
+
+	dyRequest, err := (&CommonToDYEventTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currency := dyRequest.Events[0].Properties.Currency; currency != "EUR" {
+		t.Errorf("currency = %q, want EUR", currency)
+	}
+	if locale := dyRequest.Context.Page.Locale; locale != "fr_FR" {
+		t.Errorf("DY locale = %q, want fr_FR", locale)
+	}
+}
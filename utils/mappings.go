@@ -0,0 +1,305 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MappingConfigVersion is the mapping file format understood by this build
+const MappingConfigVersion = 1
+
+//go:embed mappings/default.yaml
+var defaultMappingsFile []byte
+
+// MappingConfig - Versioned mapping tables used by the request translators
+type MappingConfig struct {
+	Version  int                     `json:"version" yaml:"version"`
+	Revision string                  `json:"revision,omitempty" yaml:"revision,omitempty"`
+	Defaults RequestDefaults         `json:"defaults" yaml:"defaults"`
+	UO       UOMappings              `json:"uo" yaml:"uo"`
+	DY       DYMappings              `json:"dy" yaml:"dy"`
+	Brands   map[string]BrandProfile `json:"brands,omitempty" yaml:"brands,omitempty"`
+
+	// Brand names the profile applied by ForBrand; empty for the base config
+	Brand string `json:"-" yaml:"-"`
+}
+
+// UOMappings - Tables between UO isEvent values and common values
+type UOMappings struct {
+	ActionToEventType     map[string]string `json:"actionToEventType" yaml:"actionToEventType"`
+	DefaultEventType      string            `json:"defaultEventType" yaml:"defaultEventType"`
+	PageTypeToCommon      map[string]string `json:"pageTypeToCommon" yaml:"pageTypeToCommon"`
+	DefaultCommonPageType string            `json:"defaultCommonPageType" yaml:"defaultCommonPageType"`
+	CommonPageTypeToUO    map[string]string `json:"commonPageTypeToUO" yaml:"commonPageTypeToUO"`
+	DefaultPageType       string            `json:"defaultPageType" yaml:"defaultPageType"`
+	EventTypeToAction     map[string]string `json:"eventTypeToAction" yaml:"eventTypeToAction"`
+	DefaultAction         string            `json:"defaultAction" yaml:"defaultAction"`
+	EventTypeToItemAction map[string]string `json:"eventTypeToItemAction" yaml:"eventTypeToItemAction"`
+	DefaultItemAction     string            `json:"defaultItemAction" yaml:"defaultItemAction"`
+}
+
+// DYMappings - Tables between DY request values and common values
+type DYMappings struct {
+	CommonPageTypeToDY    map[string]string      `json:"commonPageTypeToDY" yaml:"commonPageTypeToDY"`
+	DefaultPageType       string                 `json:"defaultPageType" yaml:"defaultPageType"`
+	PageTypeToCommon      map[string]string      `json:"pageTypeToCommon" yaml:"pageTypeToCommon"`
+	DefaultCommonPageType string                 `json:"defaultCommonPageType" yaml:"defaultCommonPageType"`
+	PageTypeToEventType   map[string]string      `json:"pageTypeToEventType" yaml:"pageTypeToEventType"`
+	DefaultEventType      string                 `json:"defaultEventType" yaml:"defaultEventType"`
+	SelectorPlacements    map[string]ISPlacement `json:"selectorPlacements,omitempty" yaml:"selectorPlacements,omitempty"`
+}
+
+var activeMappings atomic.Pointer[MappingConfig]
+
+func init() {
+	mappings, err := ParseMappings(defaultMappingsFile, "yaml")
+	if err != nil {
+		panic(fmt.Sprintf("built-in mappings: %v", err))
+	}
+	activeMappings.Store(mappings)
+}
+
+// DefaultMappings returns a fresh copy of the built-in mapping tables
+func DefaultMappings() *MappingConfig {
+	mappings, _ := ParseMappings(defaultMappingsFile, "yaml")
+	return mappings
+}
+
+// CurrentMappings returns the mapping tables translators use when none are set explicitly
+func CurrentMappings() *MappingConfig {
+	return activeMappings.Load()
+}
+
+// SetMappings validates mappings and makes them the current tables
+func SetMappings(mappings *MappingConfig) error {
+	if err := mappings.Validate(); err != nil {
+		return err
+	}
+	activeMappings.Store(mappings)
+	return nil
+}
+
+// LoadMappingsFile reads and validates a mapping file; .yaml and .yml files are parsed as
+// YAML, anything else as JSON
+func LoadMappingsFile(path string) (*MappingConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := "json"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+
+	mappings, err := ParseMappings(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mappings, nil
+}
+
+// ParseMappings parses and validates mapping tables in the given format ("yaml" or "json")
+func ParseMappings(data []byte, format string) (*MappingConfig, error) {
+	mappings := &MappingConfig{}
+
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, mappings)
+	case "json":
+		err = json.Unmarshal(data, mappings)
+	default:
+		err = fmt.Errorf("unsupported mapping format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid mappings: %w", err)
+	}
+
+	if err := mappings.Validate(); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// Validate checks the version and that every table, on its own and with each brand profile
+// applied, agrees with its reverse table, so that a value translated one way and back
+// returns unchanged
+func (m *MappingConfig) Validate() error {
+	if m.Version != MappingConfigVersion {
+		return fmt.Errorf("unsupported mapping version %d, want %d", m.Version, MappingConfigVersion)
+	}
+
+	var problems []string
+	check := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	m.validateTables(check, "")
+
+	for _, name := range m.BrandNames() {
+		brand, _ := m.ForBrand(name)
+		brand.validateTables(check, "brands."+name+".")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("inconsistent mappings: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateTables checks the defaults and tables, prefixing every problem with prefix
+func (m *MappingConfig) validateTables(check func(string, ...interface{}), prefix string) {
+	prefixed := func(format string, args ...interface{}) {
+		check(prefix+format, args...)
+	}
+
+	defaults := &m.Defaults
+	for name, value := range map[string]string{
+		"defaults.locale":      defaults.Locale,
+		"defaults.language":    defaults.Language,
+		"defaults.channel":     defaults.Channel,
+		"defaults.countryCode": defaults.CountryCode,
+		"defaults.currency":    defaults.Currency,
+	} {
+		if value == "" {
+			prefixed("%s is empty", name)
+		}
+	}
+
+	uo := &m.UO
+	checkInverse(prefixed, "uo.commonPageTypeToUO", uo.CommonPageTypeToUO, "uo.pageTypeToCommon", uo.PageTypeToCommon)
+	checkCovered(prefixed, "uo.pageTypeToCommon", uo.PageTypeToCommon, uo.DefaultCommonPageType, "uo.commonPageTypeToUO", uo.CommonPageTypeToUO)
+	checkInverse(prefixed, "uo.eventTypeToAction", uo.EventTypeToAction, "uo.actionToEventType", uo.ActionToEventType)
+	checkCovered(prefixed, "uo.actionToEventType", uo.ActionToEventType, uo.DefaultEventType, "uo.eventTypeToAction", uo.EventTypeToAction)
+	checkCovered(prefixed, "uo.actionToEventType", uo.ActionToEventType, uo.DefaultEventType, "uo.eventTypeToItemAction", uo.EventTypeToItemAction)
+	checkDefault(prefixed, "uo.defaultPageType", uo.DefaultPageType, uo.PageTypeToCommon)
+	checkDefault(prefixed, "uo.defaultAction", uo.DefaultAction, uo.ActionToEventType)
+	if uo.DefaultItemAction == "" {
+		prefixed("uo.defaultItemAction is empty")
+	}
+
+	dy := &m.DY
+	checkInverse(prefixed, "dy.pageTypeToCommon", dy.PageTypeToCommon, "dy.commonPageTypeToDY", dy.CommonPageTypeToDY)
+	checkCovered(prefixed, "dy.commonPageTypeToDY", dy.CommonPageTypeToDY, dy.DefaultPageType, "dy.pageTypeToCommon", dy.PageTypeToCommon)
+	checkDefault(prefixed, "dy.defaultCommonPageType", dy.DefaultCommonPageType, dy.CommonPageTypeToDY)
+	if dy.DefaultEventType == "" {
+		prefixed("dy.defaultEventType is empty")
+	}
+}
+
+// checkInverse requires forward[v] == k for every k -> v in reverse
+func checkInverse(check func(string, ...interface{}), reverseName string, reverse map[string]string, forwardName string, forward map[string]string) {
+	for key, value := range reverse {
+		if forward[value] != key {
+			check("%s maps %q to %q but %s maps %q to %q", reverseName, key, value, forwardName, value, forward[value])
+		}
+	}
+}
+
+// checkCovered requires every value produced by from (including its default) to be a key of to
+func checkCovered(check func(string, ...interface{}), fromName string, from map[string]string, fallback string, toName string, to map[string]string) {
+	values := map[string]bool{fallback: true}
+	for _, value := range from {
+		values[value] = true
+	}
+	for value := range values {
+		if _, exists := to[value]; !exists {
+			check("%s produces %q which is missing from %s", fromName, value, toName)
+		}
+	}
+}
+
+// checkDefault requires a default value to be a key of the table that reads it back
+func checkDefault(check func(string, ...interface{}), name, value string, table map[string]string) {
+	if _, exists := table[value]; !exists {
+		check("%s %q is missing from the reverse table", name, value)
+	}
+}
+
+// MappingReloader - Reloads a mapping file into the current tables. New tables are
+// validated before they are swapped in, so a bad file never replaces working tables.
+type MappingReloader struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	previous *MappingConfig
+}
+
+// NewMappingReloader returns a reloader for the mapping file at path
+func NewMappingReloader(path string) *MappingReloader {
+	return &MappingReloader{path: path}
+}
+
+// Path returns the mapping file path
+func (r *MappingReloader) Path() string {
+	return r.path
+}
+
+// Reload loads the mapping file and atomically makes it current. On error the current
+// tables stay active.
+func (r *MappingReloader) Reload() (*MappingConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reload()
+}
+
+// ReloadIfChanged reloads the mapping file when its modification time has changed since
+// the last attempt. It reports whether a reload was attempted.
+func (r *MappingReloader) ReloadIfChanged() (*MappingConfig, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, false, err
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return nil, false, nil
+	}
+
+	mappings, err := r.reload()
+	return mappings, true, err
+}
+
+func (r *MappingReloader) reload() (*MappingConfig, error) {
+	if info, err := os.Stat(r.path); err == nil {
+		// Remember the attempt so a broken file is not retried until it changes again
+		r.modTime = info.ModTime()
+	}
+
+	mappings, err := LoadMappingsFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.previous = activeMappings.Swap(mappings)
+	return mappings, nil
+}
+
+// Rollback restores the tables that were current before the last successful reload
+func (r *MappingReloader) Rollback() (*MappingConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.previous == nil {
+		return nil, errors.New("no previous mappings to roll back to")
+	}
+	mappings := r.previous
+	r.previous = activeMappings.Swap(mappings)
+	return mappings, nil
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultMappingsAreConsistent(t *testing.T) {
+	if err := DefaultMappings().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRejectsOneWayMappings(t *testing.T) {
+	mappings := DefaultMappings()
+
+	// A new action whose event type cannot be translated back
+	mappings.UO.ActionToEventType["Quick View"] = "quick_view"
+	// A reverse page type that does not map forward to the same value
+	mappings.UO.CommonPageTypeToUO["checkout"] = "Checkout"
+
+	err := mappings.Validate()
+	if err == nil {
+		t.Fatal("expected inconsistent mappings to be rejected")
+	}
+	for _, want := range []string{`"quick_view" which is missing from uo.eventTypeToAction`, `maps "checkout" to "Checkout"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestParseMappingsJSON(t *testing.T) {
+	_, err := ParseMappings([]byte(`{"version": 2}`), "json")
+	if err == nil || !strings.Contains(err.Error(), "unsupported mapping version 2") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMappingReloaderKeepsCurrentMappingsOnError(t *testing.T) {
+	previous := CurrentMappings()
+	t.Cleanup(func() { activeMappings.Store(previous) })
+
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	reloader := NewMappingReloader(path)
+
+	writeMappings := func(data string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := strings.Replace(string(defaultMappingsFile), "revision: builtin", "revision: updated", 1)
+	writeMappings(updated, time.Unix(1000, 0))
+	if _, reloaded, err := reloader.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("first load: reloaded=%v err=%v", reloaded, err)
+	}
+	if got := CurrentMappings().Revision; got != "updated" {
+		t.Fatalf("revision = %q, want updated", got)
+	}
+	if _, reloaded, _ := reloader.ReloadIfChanged(); reloaded {
+		t.Fatal("reloaded an unchanged file")
+	}
+
+	writeMappings("version: 2\n", time.Unix(2000, 0))
+	if _, _, err := reloader.ReloadIfChanged(); err == nil {
+		t.Fatal("expected invalid mappings to be rejected")
+	}
+	if got := CurrentMappings().Revision; got != "updated" {
+		t.Fatalf("revision after failed reload = %q, want updated", got)
+	}
+
+	if _, err := reloader.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := CurrentMappings().Revision; got != previous.Revision {
+		t.Fatalf("revision after rollback = %q, want %q", got, previous.Revision)
+	}
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+)
+
+// RedactionMode - How a redaction rule rewrites a value
+type RedactionMode string
+
+// Redaction modes
+const (
+	RedactKeep     RedactionMode = "keep"     // Leave the value as it is
+	RedactHash     RedactionMode = "hash"     // Replace the value by a keyed hash
+	RedactTruncate RedactionMode = "truncate" // Truncate IPs to their /24 (IPv4) or /48 (IPv6) network
+	RedactMask     RedactionMode = "mask"     // Mask the local part of email addresses
+	RedactDrop     RedactionMode = "drop"     // Remove the value altogether
+)
+
+// DefaultRedactionRules cover the identifiers the server logs and the payloads carry. Keys
+// with dots are paths, matching the last keys leading to a value: "user.id" matches the
+// id of any user object, where a plain "id" would match product IDs as well.
+var DefaultRedactionRules = map[string]RedactionMode{
+	"user_id":           RedactHash,
+	"remote_addr":       RedactTruncate,
+	"user_agent":        RedactHash, // With the IP, enough to fingerprint a visitor
+	"ip":                RedactTruncate,
+	"email":             RedactMask,
+	"customer_id":       RedactHash,
+	"cuid":              RedactHash,
+	"dyid":              RedactHash,
+	"dyid_server":       RedactHash,
+	"user.id":           RedactHash, // isEvent.user.id and the common user.id
+	"identifiers.value": RedactHash, // identity.identifiers[].value
+	"bestMatch.cookie":  RedactHash, // UO bestMatch.cookie, carrying session and DY IDs
+}
+
+// ParseRedactionRules parses rules written as comma-separated key=mode pairs, e.g.
+// "user_id=hash,remote_addr=truncate,user_agent=drop"
+func ParseRedactionRules(spec string) (map[string]RedactionMode, error) {
+	rules := map[string]RedactionMode{}
+	for _, rule := range strings.Split(spec, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		key, mode, found := strings.Cut(rule, "=")
+		key, mode = strings.TrimSpace(key), strings.TrimSpace(mode)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid redaction rule %q, want key=mode", rule)
+		}
+		switch RedactionMode(mode) {
+		case RedactKeep, RedactHash, RedactTruncate, RedactMask, RedactDrop:
+			rules[key] = RedactionMode(mode)
+		default:
+			return nil, fmt.Errorf("unsupported redaction mode %q for %s", mode, key)
+		}
+	}
+	return rules, nil
+}
+
+// Redactor - Rewrites personal data in log attributes and payloads by key or path. Keys
+// match regardless of case and separators, so a rule for user_agent also covers userAgent.
+type Redactor struct {
+	rules     map[string]RedactionMode
+	pathRules []pathRule
+	hashKey   []byte
+}
+
+// pathRule - A rule for the values at the end of a path of keys
+type pathRule struct {
+	keys []string
+	mode RedactionMode
+}
+
+// NewRedactor returns a redactor applying the rules. Hashes are keyed with hashKey, when
+// given, so low-entropy values such as emails cannot be recovered by hashing guesses.
+func NewRedactor(rules map[string]RedactionMode, hashKey string) *Redactor {
+	redactor := &Redactor{rules: map[string]RedactionMode{}, hashKey: []byte(hashKey)}
+	for key, mode := range rules {
+		if !strings.Contains(key, ".") {
+			redactor.rules[normalizeRedactionKey(key)] = mode
+			continue
+		}
+		rule := pathRule{mode: mode}
+		for _, segment := range strings.Split(key, ".") {
+			rule.keys = append(rule.keys, normalizeRedactionKey(segment))
+		}
+		redactor.pathRules = append(redactor.pathRules, rule)
+	}
+
+	// Longer paths are more specific and win
+	sort.SliceStable(redactor.pathRules, func(i, j int) bool {
+		a, b := redactor.pathRules[i].keys, redactor.pathRules[j].keys
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return strings.Join(a, ".") < strings.Join(b, ".")
+	})
+	return redactor
+}
+
+// mode returns the mode of the rule for the value at the end of a path of keys
+func (r *Redactor) mode(path []string) (RedactionMode, bool) {
+	for _, rule := range r.pathRules {
+		if len(rule.keys) > len(path) {
+			continue
+		}
+		matches := true
+		offset := len(path) - len(rule.keys)
+		for i, key := range rule.keys {
+			if normalizeRedactionKey(path[offset+i]) != key {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return rule.mode, true
+		}
+	}
+	mode, exists := r.rules[normalizeRedactionKey(path[len(path)-1])]
+	return mode, exists
+}
+
+// Value redacts a value under the rule for key; the second result is false when the
+// rule drops it
+func (r *Redactor) Value(key, value string) (string, bool) {
+	return r.redact([]string{key}, value)
+}
+
+// redact redacts the value at the end of a path of keys
+func (r *Redactor) redact(path []string, value string) (string, bool) {
+	mode, exists := r.mode(path)
+	if !exists || value == "" {
+		return value, true
+	}
+	switch mode {
+	case RedactHash:
+		return r.hash(value), true
+	case RedactTruncate:
+		if truncated, ok := truncateIP(value); ok {
+			return truncated, true
+		}
+		return r.hash(value), true
+	case RedactMask:
+		if masked, ok := maskEmail(value); ok {
+			return masked, true
+		}
+		return r.hash(value), true
+	case RedactDrop:
+		return "", false
+	}
+	return value, true
+}
+
+// ReplaceAttr redacts slog attributes; use it as slog.HandlerOptions.ReplaceAttr
+func (r *Redactor) ReplaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	path := append(append([]string(nil), groups...), attr.Key)
+	if _, exists := r.mode(path); !exists {
+		return attr
+	}
+	value, keep := r.redact(path, attr.Value.Resolve().String())
+	if !keep {
+		return slog.Attr{}
+	}
+	return slog.String(attr.Key, value)
+}
+
+// Payload returns the JSON document of a payload with every string value whose key or
+// path has a rule redacted
+func (r *Redactor) Payload(payload interface{}) (interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return r.redactDocument(nil, document), nil
+}
+
+// redactDocument redacts a JSON node found at the end of a path of object keys; array
+// indices are not part of paths
+func (r *Redactor) redactDocument(path []string, document interface{}) interface{} {
+	switch node := document.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			keyPath := append(path[:len(path):len(path)], key)
+			if str, ok := value.(string); ok {
+				redacted, keep := r.redact(keyPath, str)
+				if !keep {
+					delete(node, key)
+					continue
+				}
+				node[key] = redacted
+				continue
+			}
+			node[key] = r.redactDocument(keyPath, value)
+		}
+	case []interface{}:
+		for i, value := range node {
+			node[i] = r.redactDocument(path, value)
+		}
+	}
+	return document
+}
+
+// hash returns a short hex digest of the value, keyed when the redactor has a key
+func (r *Redactor) hash(value string) string {
+	var sum []byte
+	if len(r.hashKey) > 0 {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(value))
+		sum = digest[:]
+	}
+	return hex.EncodeToString(sum[:8])
+}
+
+// truncateIP truncates an IP, host:port address or comma-separated IP list to the /24
+// (IPv4) or /48 (IPv6) networks, dropping ports
+func truncateIP(value string) (string, bool) {
+	addresses := strings.Split(value, ",")
+	for i, address := range addresses {
+		address = strings.TrimSpace(address)
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return "", false
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			addresses[i] = ipv4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			addresses[i] = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+	return strings.Join(addresses, ", "), true
+}
+
+// maskEmail keeps the first character of the local part and the domain of an email
+func maskEmail(value string) (string, bool) {
+	local, domain, found := strings.Cut(value, "@")
+	if !found || local == "" || domain == "" {
+		return "", false
+	}
+	return local[:1] + "***@" + domain, true
+}
+
+// normalizeRedactionKey lowercases a key and drops its separators
+func normalizeRedactionKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "").Replace(key))
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactorModes(t *testing.T) {
+	redactor := NewRedactor(DefaultRedactionRules, "")
+
+	tests := []struct {
+		key, value, want string
+	}{
+		{"remote_addr", "203.0.113.77:54321", "203.0.113.0"},
+		{"ip", "2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{"ip", "203.0.113.77, 198.51.100.9", "203.0.113.0, 198.51.100.0"},
+		{"email", "jane.doe@example.com", "j***@example.com"},
+		{"customerId", "cust-42", redactor.hash("cust-42")},
+		{"user_agent", "Mozilla/5.0", redactor.hash("Mozilla/5.0")},
+		{"user_id", "", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := redactor.Value(tt.key, tt.value); got != tt.want {
+			t.Errorf("%s %q = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+
+	// Values a mode cannot parse are hashed rather than passed through
+	if got, _ := redactor.Value("ip", "unknown"); got == "unknown" {
+		t.Error("unparseable IP passed through")
+	}
+
+	keyed := NewRedactor(DefaultRedactionRules, "secret")
+	if keyed.hash("cust-42") == redactor.hash("cust-42") {
+		t.Error("hash key ignored")
+	}
+}
+
+func TestParseRedactionRules(t *testing.T) {
+	rules, err := ParseRedactionRules("user_agent=drop, user_id=keep,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules["user_agent"] != RedactDrop || rules["user_id"] != RedactKeep || len(rules) != 2 {
+		t.Errorf("rules = %v", rules)
+	}
+
+	for _, spec := range []string{"user_id", "user_id=scramble"} {
+		if _, err := ParseRedactionRules(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestRedactorReplaceAttr(t *testing.T) {
+	rules := map[string]RedactionMode{"user_id": RedactHash, "remote_addr": RedactTruncate, "user_agent": RedactDrop}
+	redactor := NewRedactor(rules, "")
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: redactor.ReplaceAttr}))
+	logger.Info("Translation successful", "user_id", "visitor-1", "remote_addr", "203.0.113.77:54321", "user_agent", "Mozilla/5.0", "status", 200)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["user_id"] != redactor.hash("visitor-1") || entry["remote_addr"] != "203.0.113.0" {
+		t.Errorf("entry = %v", entry)
+	}
+	if _, exists := entry["user_agent"]; exists {
+		t.Error("dropped attribute logged")
+	}
+	if entry["status"] != float64(200) || entry["msg"] != "Translation successful" {
+		t.Errorf("unredacted attributes changed: %v", entry)
+	}
+}
+
+func TestDefaultRedactionRulesCoverLoggedAttributes(t *testing.T) {
+	redactor := NewRedactor(DefaultRedactionRules, "")
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: redactor.ReplaceAttr}))
+	logger.Info("Translation successful", "user_id", "visitor-1", "remote_addr", "203.0.113.77:54321", "user_agent", "Mozilla/5.0")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"user_id":     redactor.hash("visitor-1"),
+		"remote_addr": "203.0.113.0",
+		"user_agent":  redactor.hash("Mozilla/5.0"),
+	} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %s", key, entry[key], want)
+		}
+	}
+}
+
+func TestRedactorPayload(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			User: IsEventUser{
+				ID:         "visitor-1",
+				Attributes: IsEventUserAttributes{CustomerID: "cust-42", Email: "jane.doe@example.com"},
+			},
+			Device:  &IsEventDevice{IP: "203.0.113.77", UserAgent: "Mozilla/5.0"},
+			Catalog: &IsEventCatalog{Product: &IsEventProduct{ID: "sku-1"}},
+		},
+		BestMatch: map[string]interface{}{"cookie": "_dyid=visitor-1", "country": "US"},
+	}
+
+	redactor := NewRedactor(DefaultRedactionRules, "")
+	redacted, err := redactor.Payload(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(redacted)
+	for _, leaked := range []string{"visitor-1", "jane.doe", "203.0.113.77", "cust-42", "Mozilla/5.0"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("%s leaked: %s", leaked, data)
+		}
+	}
+	for _, kept := range []string{`"_id":"sku-1"`, `"country":"US"`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("unredacted field %s changed: %s", kept, data)
+		}
+	}
+
+	// Identity values are redacted by path, whatever their namespace
+	commonRequest := &CommonRequestFormat{
+		User:     UserContext{ID: "visitor-1"},
+		Identity: &IdentityContext{Identifiers: []Identifier{{Type: IdentifierAnonymous, Namespace: NamespaceUO, Value: "visitor-1"}}},
+	}
+	redacted, err = redactor.Payload(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(redacted)
+	if strings.Contains(string(data), "visitor-1") || !strings.Contains(string(data), redactor.hash("visitor-1")) {
+		t.Errorf("visitor ID not hashed: %s", data)
+	}
+	if uoRequest.IsEvent.User.Attributes.Email != "jane.doe@example.com" {
+		t.Error("payload modified")
+	}
+}
@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Kind distinguishes request payloads from response payloads
+type Kind string
+
+const (
+	KindRequest  Kind = "request"
+	KindResponse Kind = "response"
+)
+
+// Format names known to the default registry
+const (
+	FormatUO           = "uo"
+	FormatCommon       = "common"
+	FormatDY           = "dy"
+	FormatDYEvent      = "dy-event"
+	FormatDYEngagement = "dy-engagement"
+	FormatIS           = "is"
+)
+
+// ErrUnsupportedPair is returned when no translator (direct or via Common) exists for a pair
+var ErrUnsupportedPair = errors.New("unsupported translation pair")
+
+// ErrUnknownFormat is returned when a format name has not been registered
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Translator - Shared abstraction over every format-to-format translator
+type Translator interface {
+	Translate(ctx context.Context, input interface{}) (interface{}, error)
+}
+
+// Identified is implemented by payloads that can report the user they describe
+type Identified interface {
+	UserIdentifier() string
+}
+
+// TranslatorFunc adapts a plain function to the Translator interface
+type TranslatorFunc func(ctx context.Context, input interface{}) (interface{}, error)
+
+// Translate calls f(ctx, input)
+func (f TranslatorFunc) Translate(ctx context.Context, input interface{}) (interface{}, error) {
+	return f(ctx, input)
+}
+
+// Typed wraps a translate function with concrete types so it can be registered
+func Typed[In, Out any](fn func(ctx context.Context, input *In) (*Out, error)) Translator {
+	return TranslatorFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		typed, ok := input.(*In)
+		if !ok {
+			return nil, fmt.Errorf("unexpected input type %T, want %T", input, typed)
+		}
+		output, err := fn(ctx, typed)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
+	})
+}
+
+// Chain runs translators in sequence, feeding each output into the next
+func Chain(translators ...Translator) Translator {
+	return TranslatorFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		current := input
+		for _, translator := range translators {
+			output, err := translator.Translate(ctx, current)
+			if err != nil {
+				return nil, err
+			}
+			current = output
+		}
+		return current, nil
+	})
+}
+
+type formatKey struct {
+	kind Kind
+	name string
+}
+
+type pairKey struct {
+	kind Kind
+	from string
+	to   string
+}
+
+// Registry - Formats and translators keyed by kind and format name.
+// Pairs without a direct translator are resolved through the Common format.
+type Registry struct {
+	mu          sync.RWMutex
+	formats     map[formatKey]func() interface{}
+	translators map[pairKey]Translator
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		formats:     make(map[formatKey]func() interface{}),
+		translators: make(map[pairKey]Translator),
+	}
+}
+
+// NewDefaultRegistry returns a registry with all built-in formats and translators
+// Each translation snapshots the current mapping tables, with the brand profile from the
+// context or the payload applied, so a concurrent reload cannot mix two mapping sets
+// within one payload.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+
+	r.RegisterFormat(KindRequest, FormatUO, func() interface{} { return &UOCurrentRequestFormat{} })
+	r.RegisterFormat(KindRequest, FormatCommon, func() interface{} { return &CommonRequestFormat{} })
+	r.RegisterFormat(KindRequest, FormatDY, func() interface{} { return &DYChooseRequest{} })
+	r.RegisterFormat(KindRequest, FormatDYEvent, func() interface{} { return &DYEventRequest{} })
+	r.RegisterFormat(KindRequest, FormatDYEngagement, func() interface{} { return &DYEngagementRequest{} })
+
+	r.RegisterFormat(KindResponse, FormatCommon, func() interface{} { return &CommonResponseFormat{} })
+	r.RegisterFormat(KindResponse, FormatIS, func() interface{} { return &ISResponseFormat{} })
+	r.RegisterFormat(KindResponse, FormatDY, func() interface{} { return &DYChooseResponse{} })
+
+	r.Register(KindRequest, FormatUO, FormatCommon, Typed(func(ctx context.Context, in *UOCurrentRequestFormat) (*CommonRequestFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&UOToCommonTranslator{Mappings: mappings, SessionID: SessionIDFromContext(ctx)}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatCommon, FormatUO, Typed(func(ctx context.Context, in *CommonRequestFormat) (*UOCurrentRequestFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&CommonToUOTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatCommon, FormatDY, Typed(func(ctx context.Context, in *CommonRequestFormat) (*DYChooseRequest, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&CommonToDYRequestTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatDY, FormatCommon, Typed(func(ctx context.Context, in *DYChooseRequest) (*CommonRequestFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&DYToCommonRequestTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatCommon, FormatDYEvent, Typed(func(ctx context.Context, in *CommonRequestFormat) (*DYEventRequest, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&CommonToDYEventTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatDYEvent, FormatCommon, Typed(func(ctx context.Context, in *DYEventRequest) (*CommonRequestFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&DYEventToCommonTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatCommon, FormatDYEngagement, Typed(func(ctx context.Context, in *CommonRequestFormat) (*DYEngagementRequest, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&CommonToDYEngagementTranslator{Mappings: mappings}).Translate(in)
+	}))
+	r.Register(KindRequest, FormatDYEngagement, FormatCommon, Typed(func(ctx context.Context, in *DYEngagementRequest) (*CommonRequestFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&DYEngagementToCommonTranslator{Mappings: mappings}).Translate(in)
+	}))
+
+	r.Register(KindResponse, FormatCommon, FormatIS, Typed(func(ctx context.Context, in *CommonResponseFormat) (*ISResponseFormat, error) {
+		return (&CommonToISResponseTranslator{}).Translate(in)
+	}))
+	r.Register(KindResponse, FormatIS, FormatCommon, Typed(func(ctx context.Context, in *ISResponseFormat) (*CommonResponseFormat, error) {
+		return (&ISToCommonResponseTranslator{}).Translate(in)
+	}))
+	r.Register(KindResponse, FormatCommon, FormatDY, Typed(func(ctx context.Context, in *CommonResponseFormat) (*DYChooseResponse, error) {
+		return (&CommonToDYResponseTranslator{}).Translate(in)
+	}))
+	r.Register(KindResponse, FormatDY, FormatCommon, Typed(func(ctx context.Context, in *DYChooseResponse) (*CommonResponseFormat, error) {
+		return (&DYToCommonResponseTranslator{}).Translate(in)
+	}))
+
+	// Direct DY <-> IS bridge so legacy IS clients can be served DY decisions
+	r.Register(KindResponse, FormatDY, FormatIS, Typed(func(ctx context.Context, in *DYChooseResponse) (*ISResponseFormat, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&DYToISResponseTranslator{Placements: mappings.DY.SelectorPlacements}).Translate(in)
+	}))
+	r.Register(KindResponse, FormatIS, FormatDY, Typed(func(ctx context.Context, in *ISResponseFormat) (*DYChooseResponse, error) {
+		mappings, err := mappingsFor(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return (&ISToDYResponseTranslator{Placements: mappings.DY.SelectorPlacements}).Translate(in)
+	}))
+
+	return r
+}
+
+// RegisterFormat registers a format and a constructor for its zero payload
+func (r *Registry) RegisterFormat(kind Kind, name string, newPayload func() interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formats[formatKey{kind: kind, name: name}] = newPayload
+}
+
+// Register registers a direct translator for a pair, replacing any existing one
+func (r *Registry) Register(kind Kind, from, to string, translator Translator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.translators[pairKey{kind: kind, from: from, to: to}] = translator
+}
+
+// NewPayload returns an empty payload of the named format, ready for decoding
+func (r *Registry) NewPayload(kind Kind, name string) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	newPayload, exists := r.formats[formatKey{kind: kind, name: name}]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s %s", ErrUnknownFormat, kind, name)
+	}
+	return newPayload(), nil
+}
+
+// Lookup returns the translator for a pair, chaining through Common when no direct one exists
+func (r *Registry) Lookup(kind Kind, from, to string) (Translator, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if translator, exists := r.lookup(kind, from, to); exists {
+		return translator, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s to %s", ErrUnsupportedPair, kind, from, to)
+}
+
+func (r *Registry) lookup(kind Kind, from, to string) (Translator, bool) {
+	if from == to {
+		return nil, false
+	}
+
+	if translator, exists := r.translators[pairKey{kind: kind, from: from, to: to}]; exists {
+		return translator, true
+	}
+
+	// Chain through the Common hub
+	toCommon, exists := r.translators[pairKey{kind: kind, from: from, to: FormatCommon}]
+	if !exists {
+		return nil, false
+	}
+	fromCommon, exists := r.translators[pairKey{kind: kind, from: FormatCommon, to: to}]
+	if !exists {
+		return nil, false
+	}
+	return Chain(toCommon, fromCommon), true
+}
+
+// Formats returns the sorted format names registered for a kind
+func (r *Registry) Formats(kind Kind) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for key := range r.formats {
+		if key.kind == kind {
+			names = append(names, key.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pairs returns every supported pair for a kind as "from-to-to", including chained pairs
+func (r *Registry) Pairs(kind Kind) []string {
+	formats := r.Formats(kind)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var pairs []string
+	for _, from := range formats {
+		for _, to := range formats {
+			if _, exists := r.lookup(kind, from, to); exists {
+				pairs = append(pairs, PairName(from, to))
+			}
+		}
+	}
+	return pairs
+}
+
+// PairName formats a pair the way it appears in translation routes, e.g. "uo-to-common"
+func PairName(from, to string) string {
+	return from + "-to-" + to
+}
@@ -1,10 +1,13 @@
 package utils
 
 import (
-	"fmt"
+	"encoding/json"
 	"time"
 )
 
+// now is the clock used for generated timestamps and session IDs; tests pin it
+var now = time.Now
+
 // CommonRequestFormat - Updated to preserve bestMatch and queries
 type CommonRequestFormat struct {
 	// Preserved from UO Current Format
@@ -13,23 +16,41 @@ type CommonRequestFormat struct {
 	BestMatch             map[string]interface{} `json:"bestMatch"`
 	Queries               map[string]interface{} `json:"queries"`
 
+	// Brand profile the request was translated under, if one matched
+	Brand string `json:"brand,omitempty"`
+
 	// Abstracted from isEvent
 	User      UserContext      `json:"user"`
+	Identity  *IdentityContext `json:"identity,omitempty"`
 	Session   SessionContext   `json:"session"`
 	Event     EventContext     `json:"event"`
 	Page      PageContext      `json:"page"`
+	Search    *SearchContext   `json:"search,omitempty"`
 	Products  []ProductContext `json:"products,omitempty"`
+	Order     *OrderContext    `json:"order,omitempty"`
+
+	// Engagements reported against served decisions
+	Engagements []EngagementContext `json:"engagements,omitempty"`
+
 	Device    DeviceContext    `json:"device"`
+	Geo       *GeoContext      `json:"geo,omitempty"`
+	Consent   *ConsentContext  `json:"consent,omitempty"`
 	Timestamp string           `json:"timestamp"`
+
+	// Source fields the common sections cannot represent, per origin format
+	Extensions *RequestExtensions `json:"extensions,omitempty"`
 }
 
-// UOCurrentRequestFormat - Current UO format structure
+// UOCurrentRequestFormat - Current UO format structure. It and the isEvent structs that
+// carry Unmapped keep the keys they do not model as raw JSON.
 type UOCurrentRequestFormat struct {
-	Personalized          bool                   `json:"personalized"`
+	Personalized          *bool                  `json:"personalized,omitempty"`
 	ContentfulEnvironment string                 `json:"contentfulEnvironment"`
 	BestMatch             map[string]interface{} `json:"bestMatch"`
 	Queries               map[string]interface{} `json:"queries"`
 	IsEvent               IsEventContext         `json:"isEvent"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 // Context structures (from previous definitions)
@@ -55,11 +76,14 @@ type EventContext struct {
 }
 
 type PageContext struct {
-	Type     string `json:"type"`
-	URL      string `json:"url"`
-	Referrer string `json:"referrer,omitempty"`
-	Title    string `json:"title,omitempty"`
-	Language string `json:"language,omitempty"`
+	Type         string   `json:"type"`
+	URL          string   `json:"url"`
+	Referrer     string   `json:"referrer,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Language     string   `json:"language,omitempty"`
+	Locale       string   `json:"locale,omitempty"`
+	CategoryPath []string `json:"categoryPath,omitempty"`
+	URLInfo      *URLInfo `json:"urlInfo,omitempty"`
 }
 
 type ProductContext struct {
@@ -70,14 +94,56 @@ type ProductContext struct {
 	Price      float64                `json:"price,omitempty"`
 	Currency   string                 `json:"currency,omitempty"`
 	Quantity   int                    `json:"quantity,omitempty"`
+	Role       string                 `json:"role,omitempty"`
 	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
+// Product roles; products without a role are treated as viewed
+const (
+	ProductRoleViewed    = "viewed"
+	ProductRoleInCart    = "in-cart"
+	ProductRolePurchased = "purchased"
+)
+
+// productsWithRole returns the products that have one of the given roles
+func productsWithRole(products []ProductContext, roles ...string) []ProductContext {
+	var matched []ProductContext
+	for _, product := range products {
+		role := product.Role
+		if role == "" {
+			role = ProductRoleViewed
+		}
+		for _, wanted := range roles {
+			if role == wanted {
+				matched = append(matched, product)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// OrderContext - A completed order; its line items are the products with role purchased
+type OrderContext struct {
+	ID        string            `json:"id"`
+	Revenue   float64           `json:"revenue"`
+	Currency  string            `json:"currency,omitempty"`
+	Discounts []DiscountContext `json:"discounts,omitempty"`
+}
+
+type DiscountContext struct {
+	Code   string  `json:"code,omitempty"`
+	Amount float64 `json:"amount"`
+}
+
 type DeviceContext struct {
 	Type      string `json:"type,omitempty"`
 	UserAgent string `json:"userAgent,omitempty"`
 	IP        string `json:"ip,omitempty"`
 	Platform  string `json:"platform,omitempty"`
+	Browser   string `json:"browser,omitempty"`
+	OS        string `json:"os,omitempty"`
+	Bot       bool   `json:"bot,omitempty"`
 }
 
 type IsEventContext struct {
@@ -86,10 +152,13 @@ type IsEventContext struct {
 	Flags      IsEventFlags   `json:"flags"`
 	Action     string         `json:"action"`
 	ItemAction string         `json:"itemAction,omitempty"`
-	Catalog    IsEventCatalog `json:"catalog,omitempty"`
-	Cart       interface{}    `json:"cart,omitempty"`
-	Device     *IsEventDevice `json:"device,omitempty"`
-	Timestamp  string         `json:"timestamp,omitempty"`
+	Catalog    *IsEventCatalog `json:"catalog,omitempty"`
+	Cart       *IsEventCart    `json:"cart,omitempty"`
+	Order      *IsEventOrder   `json:"order,omitempty"`
+	Device     *IsEventDevice  `json:"device,omitempty"`
+	Timestamp  string          `json:"timestamp,omitempty"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 type IsEventSource struct {
@@ -99,11 +168,15 @@ type IsEventSource struct {
 	Channel     string `json:"channel"`
 	PageType    string `json:"pageType"`
 	Referrer    string `json:"referrer,omitempty"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 type IsEventUser struct {
 	ID         string                `json:"id"`
 	Attributes IsEventUserAttributes `json:"attributes"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 type IsEventUserAttributes struct {
@@ -116,15 +189,17 @@ type IsEventUserAttributes struct {
 	URBNIsLoyalty                  bool     `json:"urbn_is_loyalty"`
 	TierStatus                     string   `json:"tier_status"`
 	CustomerNotificationPermission string   `json:"customer_notification_permission,omitempty"`
-	URBNMbrA                       bool     `json:"urbn_mbr_a"`
-	URBNMbrB                       bool     `json:"urbn_mbr_b"`
-	URBNMbrMarketA                 bool     `json:"urbn_mbr_market_a"`
-	URBNMbrMarketB                 bool     `json:"urbn_mbr_market_b"`
+	URBNMbrA                       *bool    `json:"urbn_mbr_a,omitempty"`
+	URBNMbrB                       *bool    `json:"urbn_mbr_b,omitempty"`
+	URBNMbrMarketA                 *bool    `json:"urbn_mbr_market_a,omitempty"`
+	URBNMbrMarketB                 *bool    `json:"urbn_mbr_market_b,omitempty"`
 	CountryCode                    string   `json:"countryCode"`
 	RegionCode                     string   `json:"regionCode,omitempty"`
 	Email                          string   `json:"email,omitempty"`
 	LoyaltyTier                    string   `json:"loyaltyTier,omitempty"`
 	Segments                       []string `json:"segments,omitempty"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 type IsEventFlags map[string]interface{}
@@ -148,70 +223,197 @@ type IsEventCategory struct {
 	ID string `json:"_id"`
 }
 
+type IsEventCart struct {
+	Complete *IsEventCartContents `json:"complete,omitempty"`
+}
+
+type IsEventCartContents struct {
+	Product []IsEventCartItem `json:"Product"`
+}
+
+type IsEventCartItem struct {
+	ID       string  `json:"_id"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+}
+
+// IsEventOrder - A completed order, keyed by catalog type like the cart
+type IsEventOrder struct {
+	Product *IsEventOrderDetails `json:"Product,omitempty"`
+}
+
+type IsEventOrderDetails struct {
+	OrderID    string            `json:"orderId"`
+	TotalValue float64           `json:"totalValue"`
+	Currency   string            `json:"currency,omitempty"`
+	LineItems  []IsEventCartItem `json:"lineItems,omitempty"`
+	Discounts  []IsEventDiscount `json:"discounts,omitempty"`
+}
+
+type IsEventDiscount struct {
+	Code   string  `json:"code,omitempty"`
+	Amount float64 `json:"amount"`
+}
+
+// Items returns the cart line items, if any
+func (c *IsEventCart) Items() []IsEventCartItem {
+	if c == nil || c.Complete == nil {
+		return nil
+	}
+	return c.Complete.Product
+}
+
+// Item returns the catalog product, if any
+func (c *IsEventCatalog) Item() *IsEventProduct {
+	if c == nil {
+		return nil
+	}
+	return c.Product
+}
+
 type IsEventDevice struct {
 	Type      string `json:"type,omitempty"`
 	UserAgent string `json:"userAgent,omitempty"`
 	IP        string `json:"ip,omitempty"`
 	Platform  string `json:"platform,omitempty"`
+
+	Unmapped map[string]json.RawMessage `json:"-"`
 }
 
 // UOToCommonTranslator - Translates UO Current Format to Common Request Format
-type UOToCommonTranslator struct{}
+type UOToCommonTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+	// SessionID is the session the caller received with the request, if any
+	SessionID string
+}
+
+func (t *UOToCommonTranslator) config() *MappingConfig {
+	if t.Mappings != nil {
+		return t.Mappings
+	}
+	return CurrentMappings()
+}
+
+func (t *UOToCommonTranslator) mappings() *UOMappings {
+	return &t.config().UO
+}
 
 func (t *UOToCommonTranslator) Translate(uoRequest *UOCurrentRequestFormat) (*CommonRequestFormat, error) {
 	// Abstract user from isEvent.user
 	user := t.extractUser(&uoRequest.IsEvent.User)
-
-	// Preserve flags, source channel, itemAction, catalog, and cart in user attributes
-	user.Attributes["flags"] = uoRequest.IsEvent.Flags
-	user.Attributes["source_channel"] = uoRequest.IsEvent.Source.Channel
-	user.Attributes["item_action"] = uoRequest.IsEvent.ItemAction
-	user.Attributes["catalog"] = uoRequest.IsEvent.Catalog
-	user.Attributes["cart"] = uoRequest.IsEvent.Cart
-
-	// Generate session (UO doesn't explicitly track this)
-	session := SessionContext{
-		ID:    t.generateSessionID(),
-		IsNew: true, // Default assumption
-	}
+	// Consent decides before anything else whether the user's IDs may be linked
+	consent := &ConsentContext{Granted: !uoRequest.IsEvent.User.Attributes.CustomerNonConsent}
+	identity := resolveIdentity(map[string]string{
+		NamespaceUO:       uoRequest.IsEvent.User.ID,
+		NamespaceCustomer: uoRequest.IsEvent.User.Attributes.CustomerID,
+	}, consent.Granted)
 
 	// Abstract event from isEvent
 	event := t.extractEvent(&uoRequest.IsEvent)
 
 	// Abstract page from isEvent.source
 	page := t.extractPage(&uoRequest.IsEvent.Source)
+	if catalog := uoRequest.IsEvent.Catalog; catalog != nil && catalog.Category != nil && catalog.Category.ID != "" {
+		page.CategoryPath = []string{catalog.Category.ID}
+	}
+
+	// Abstract the search from the page URL and the shoppingPageContent query
+	search := extractSearch(&page, uoRequest.Queries)
 
-	// Abstract products from isEvent.catalog
-	products := t.extractProducts(&uoRequest.IsEvent.Catalog)
+	// Abstract products from isEvent.catalog, isEvent.cart and isEvent.order
+	products := t.extractProducts(&uoRequest.IsEvent, event.Type)
 
-	// Abstract device from isEvent.device
-	device := t.extractDevice(uoRequest.IsEvent.Device)
+	// Abstract order from isEvent.order
+	order := t.extractOrder(uoRequest.IsEvent.Order)
+
+	// Abstract device from isEvent.device and the source.application triplet
+	device := t.extractDevice(uoRequest.IsEvent.Device, uoRequest.IsEvent.Source.Application)
+
+	// Abstract geo from the bestMatch lookup and the user's market
+	userAttributes := &uoRequest.IsEvent.User.Attributes
+	geo := extractGeo(uoRequest.BestMatch, userAttributes.CountryCode, userAttributes.RegionCode)
 
 	// Extract timestamp
 	timestamp := uoRequest.IsEvent.Timestamp
 	if timestamp == "" {
-		timestamp = time.Now().UTC().Format(time.RFC3339)
+		timestamp = now().UTC().Format(time.RFC3339)
 	}
 
+	// Resolve session (UO doesn't explicitly track this)
+	session := t.extractSession(uoRequest, &device, timestamp)
+
 	// Build common format - preserving bestMatch and queries exactly
 	commonRequest := &CommonRequestFormat{
 		// Preserved sections
-		Personalized:          uoRequest.Personalized,
+		Personalized:          uoRequest.Personalized != nil && *uoRequest.Personalized,
 		ContentfulEnvironment: uoRequest.ContentfulEnvironment,
 		BestMatch:             uoRequest.BestMatch,
 		Queries:               uoRequest.Queries,
+		Brand:                 t.config().Brand,
 
 		// Abstracted sections
 		User:      user,
+		Identity:  identity,
 		Session:   session,
 		Event:     event,
 		Page:      page,
+		Search:    search,
 		Products:  products,
+		Order:     order,
 		Device:    device,
+		Geo:       geo,
+		Consent:   consent,
 		Timestamp: timestamp,
+
+		// Unmapped isEvent fields for lossless reverse translation
+		Extensions: &RequestExtensions{
+			UO: t.extractExtensions(uoRequest),
+		},
+	}
+
+	// Suppress identifiers the user did not consent to share
+	return enforceConsent(commonRequest), nil
+}
+
+func (t *UOToCommonTranslator) extractExtensions(uoRequest *UOCurrentRequestFormat) *UOExtensions {
+	isEvent := &uoRequest.IsEvent
+
+	// Cart items become products; only an empty cart needs keeping
+	var emptyCart *IsEventCart
+	if isEvent.Cart != nil && len(isEvent.Cart.Items()) == 0 {
+		emptyCart = isEvent.Cart
+	}
+
+	// Keys the structs do not model, by the path of their object
+	unmapped := map[string]map[string]json.RawMessage{}
+	for path, keys := range map[string]map[string]json.RawMessage{
+		uoPathRoot:    uoRequest.Unmapped,
+		uoPathIsEvent: isEvent.Unmapped,
+		uoPathSource:  isEvent.Source.Unmapped,
+		uoPathUser:    isEvent.User.Unmapped,
+	} {
+		if len(keys) > 0 {
+			unmapped[path] = keys
+		}
+	}
+	if len(unmapped) == 0 {
+		unmapped = nil
 	}
 
-	return commonRequest, nil
+	return &UOExtensions{
+		Locale:              isEvent.Source.Locale,
+		Channel:             isEvent.Source.Channel,
+		PageType:            isEvent.Source.PageType,
+		UserAttributes:      isEvent.User.Attributes,
+		Flags:               isEvent.Flags,
+		Catalog:             isEvent.Catalog,
+		EmptyCart:           emptyCart,
+		Device:              isEvent.Device,
+		TimestampGenerated:  isEvent.Timestamp == "",
+		PersonalizedOmitted: uoRequest.Personalized == nil,
+		Unmapped:            unmapped,
+	}
 }
 
 func (t *UOToCommonTranslator) extractUser(isEventUser *IsEventUser) UserContext {
@@ -256,22 +458,10 @@ func (t *UOToCommonTranslator) extractUser(isEventUser *IsEventUser) UserContext
 
 func (t *UOToCommonTranslator) extractEvent(isEvent *IsEventContext) EventContext {
 	// Map UO actions to common event types
-	actionToEventType := map[string]string{
-		"Page View":      "page_view",
-		"Product Detail": "product_view",
-		"Add to Cart":    "add_to_cart",
-		"Purchase":       "purchase",
-		"CategoryView":   "category_view",
-		"Cart":           "cart_view",
-		"Search":         "search",
-		"Login":          "login",
-		"Signup":         "signup",
-		"ContentView":    "page_view",
-	}
-
-	eventType, exists := actionToEventType[isEvent.Action]
+	mappings := t.mappings()
+	eventType, exists := mappings.ActionToEventType[isEvent.Action]
 	if !exists {
-		eventType = "page_view"
+		eventType = mappings.DefaultEventType
 	}
 
 	return EventContext{
@@ -284,53 +474,106 @@ func (t *UOToCommonTranslator) extractEvent(isEvent *IsEventContext) EventContex
 
 func (t *UOToCommonTranslator) extractPage(source *IsEventSource) PageContext {
 	// Map UO page types to common page types
-	pageTypeMapping := map[string]string{
-		"homepage": "homepage",
-		"home":     "homepage", // Handle both home and homepage
-		"product":  "product",
-		"category": "category",
-		"cart":     "cart",
-		"Cart":     "cart", // Handle capital C
-		"checkout": "checkout",
-		"search":   "search",
-		"content":  "other",
-	}
-
-	pageType, exists := pageTypeMapping[source.PageType]
+	mappings := t.mappings()
+	urlInfo := parsePageURL(source.URL)
+	pageType, exists := mappings.PageTypeToCommon[source.PageType]
 	if !exists {
-		pageType = "other"
+		// Fall back to the page type implied by the URL when the UO page type is missing or unknown
+		pageType = mappings.DefaultCommonPageType
+		if urlInfo != nil {
+			pageType = urlInfo.PageType
+		}
+	}
+
+	// Carry the source locale in its BCP-47 form, else the default locale
+	defaults := &t.config().Defaults
+	locale := NormalizeLocale(source.Locale)
+	if locale == "" {
+		locale = NormalizeLocale(defaults.Locale)
+	}
+	language := localeLanguage(locale)
+	if language == "" {
+		language = defaults.Language
 	}
 
 	return PageContext{
 		Type:     pageType,
 		URL:      source.URL,
 		Referrer: source.Referrer,
-		Language: "en", // Default
+		Language: language,
+		Locale:   locale,
+		URLInfo:  urlInfo,
 	}
 }
 
-func (t *UOToCommonTranslator) extractProducts(catalog *IsEventCatalog) []ProductContext {
-	if catalog.Product == nil {
+func (t *UOToCommonTranslator) extractProducts(isEvent *IsEventContext, eventType string) []ProductContext {
+	var products []ProductContext
+
+	if catalogProduct := isEvent.Catalog.Item(); catalogProduct != nil {
+		products = append(products, ProductContext{
+			ID:         catalogProduct.ID,
+			Name:       catalogProduct.Name,
+			Category:   catalogProduct.Category,
+			Brand:      catalogProduct.Brand,
+			Price:      catalogProduct.Price,
+			Currency:   catalogProduct.Currency,
+			Role:       ProductRoleViewed,
+			Attributes: catalogProduct.Attributes,
+		})
+	}
+
+	// Order line items are purchased. Without an order, cart line items are purchased when
+	// the event completes the order.
+	role := ProductRoleInCart
+	if isEvent.Order != nil && isEvent.Order.Product != nil {
+		for _, item := range isEvent.Order.Product.LineItems {
+			products = append(products, ProductContext{
+				ID:       item.ID,
+				Price:    item.Price,
+				Quantity: item.Quantity,
+				Role:     ProductRolePurchased,
+			})
+		}
+	} else if eventType == "purchase" {
+		role = ProductRolePurchased
+	}
+	for _, item := range isEvent.Cart.Items() {
+		products = append(products, ProductContext{
+			ID:       item.ID,
+			Price:    item.Price,
+			Quantity: item.Quantity,
+			Role:     role,
+		})
+	}
+
+	return products
+}
+
+func (t *UOToCommonTranslator) extractOrder(isEventOrder *IsEventOrder) *OrderContext {
+	if isEventOrder == nil || isEventOrder.Product == nil {
 		return nil
 	}
 
-	product := ProductContext{
-		ID:         catalog.Product.ID,
-		Name:       catalog.Product.Name,
-		Category:   catalog.Product.Category,
-		Brand:      catalog.Product.Brand,
-		Price:      catalog.Product.Price,
-		Currency:   catalog.Product.Currency,
-		Attributes: catalog.Product.Attributes,
+	details := isEventOrder.Product
+	order := &OrderContext{
+		ID:       details.OrderID,
+		Revenue:  details.TotalValue,
+		Currency: details.Currency,
+	}
+	for _, discount := range details.Discounts {
+		order.Discounts = append(order.Discounts, DiscountContext{Code: discount.Code, Amount: discount.Amount})
 	}
 
-	return []ProductContext{product}
+	return order
 }
 
-func (t *UOToCommonTranslator) extractDevice(isEventDevice *IsEventDevice) DeviceContext {
+func (t *UOToCommonTranslator) extractDevice(isEventDevice *IsEventDevice, application string) DeviceContext {
 	device := DeviceContext{
 		Platform: "web", // Default
 	}
+	if platform, _, _ := parseApplication(application); platform != "" {
+		device.Platform = platform
+	}
 
 	if isEventDevice != nil {
 		device.Type = isEventDevice.Type
@@ -341,42 +584,90 @@ func (t *UOToCommonTranslator) extractDevice(isEventDevice *IsEventDevice) Devic
 		}
 	}
 
+	classifyDevice(&device, application)
 	return device
 }
 
-func (t *UOToCommonTranslator) generateSessionID() string {
-	return fmt.Sprintf("sess_%d", time.Now().UnixNano())
+// extractSession resolves the session from the caller's session ID, else a session cookie
+// in bestMatch.cookie, else the user (or the device, for anonymous events) and the event time
+func (t *UOToCommonTranslator) extractSession(uoRequest *UOCurrentRequestFormat, device *DeviceContext, timestamp string) SessionContext {
+	at, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		at = now()
+	}
+
+	// Anonymous visitors are keyed by their device, if it is known
+	visitor := uoRequest.IsEvent.User.ID
+	if visitor == "" && (device.IP != "" || device.UserAgent != "") {
+		visitor = device.IP + "|" + device.UserAgent
+	}
+
+	cookieHeader, _ := uoRequest.BestMatch["cookie"].(string)
+	return resolveSession(t.SessionID, cookieHeader, visitor, at)
 }
 
 // CommonToUOTranslator - Translates Common Request Format to UO Current Format
-type CommonToUOTranslator struct{}
+type CommonToUOTranslator struct {
+	// Mappings overrides the current mapping tables when set
+	Mappings *MappingConfig
+}
+
+func (t *CommonToUOTranslator) config() *MappingConfig {
+	if t.Mappings != nil {
+		return t.Mappings
+	}
+	return CurrentMappings()
+}
+
+func (t *CommonToUOTranslator) mappings() *UOMappings {
+	return &t.config().UO
+}
 
 func (t *CommonToUOTranslator) Translate(commonRequest *CommonRequestFormat) (*UOCurrentRequestFormat, error) {
+	// Suppress identifiers the user did not consent to share
+	commonRequest = enforceConsent(commonRequest)
+
 	// Reconstruct isEvent from abstracted data
 	isEvent := t.buildIsEvent(commonRequest)
 
+	// Build bestMatch from the geo context for requests that did not come with one
+	bestMatch := commonRequest.BestMatch
+	if bestMatch == nil && commonRequest.Geo != nil {
+		bestMatch = buildBestMatchGeo(commonRequest.Geo)
+	}
+
 	// Build UO format - preserving bestMatch and queries exactly
+	personalized := commonRequest.Personalized
 	uoRequest := &UOCurrentRequestFormat{
 		// Preserved sections
-		Personalized:          commonRequest.Personalized,
+		Personalized:          &personalized,
 		ContentfulEnvironment: commonRequest.ContentfulEnvironment,
-		BestMatch:             commonRequest.BestMatch,
+		BestMatch:             bestMatch,
 		Queries:               commonRequest.Queries,
 
 		// Reconstructed section
 		IsEvent: isEvent,
 	}
 
+	// Leave out what the UO request left out, unless the common request has changed it
+	if ext := commonRequest.Extensions; ext != nil && ext.UO != nil {
+		if ext.UO.PersonalizedOmitted && !personalized {
+			uoRequest.Personalized = nil
+		}
+		uoRequest.Unmapped = ext.UO.Unmapped[uoPathRoot]
+	}
+
 	return uoRequest, nil
 }
 
 func (t *CommonToUOTranslator) buildIsEvent(commonRequest *CommonRequestFormat) IsEventContext {
-	// Build isEvent.source from page
+	// Build isEvent.source from page, with the brand defaults
+	defaults := &t.config().Defaults
 	source := IsEventSource{
-		Locale:      "en_US", // Default
+		Locale:      t.sourceLocale(&commonRequest.Page),
 		Application: commonRequest.Event.Source,
 		URL:         commonRequest.Page.URL,
-		Channel:     "Server", // UO default
+		Channel:     defaults.Channel,
 		PageType:    t.mapPageType(commonRequest.Page.Type),
 		Referrer:    commonRequest.Page.Referrer,
 	}
@@ -390,8 +681,8 @@ func (t *CommonToUOTranslator) buildIsEvent(commonRequest *CommonRequestFormat)
 
 	// Build isEvent.user from user
 	user := IsEventUser{
-		ID:         commonRequest.User.ID,
-		Attributes: t.buildUserAttributes(commonRequest.User),
+		ID:         firstNonEmpty(commonRequest.Identity.Value(NamespaceUO), commonRequest.User.ID),
+		Attributes: t.buildUserAttributes(commonRequest),
 	}
 
 	// Build isEvent.flags from preserved data
@@ -407,8 +698,8 @@ func (t *CommonToUOTranslator) buildIsEvent(commonRequest *CommonRequestFormat)
 		}
 	}
 
-	// Build isEvent.catalog from products
-	catalog := t.buildCatalog(commonRequest.Products)
+	// Build isEvent.catalog from products and the page category
+	catalog := t.buildCatalog(commonRequest.Products, &commonRequest.Page)
 	
 	// Restore catalog from user attributes if available
 	if catalogData, exists := commonRequest.User.Attributes["catalog"]; exists {
@@ -428,10 +719,17 @@ func (t *CommonToUOTranslator) buildIsEvent(commonRequest *CommonRequestFormat)
 		}
 	}
 	
+	// Build isEvent.order from the order and purchased products, and isEvent.cart from
+	// the products still in the cart
+	order := t.buildOrder(commonRequest.Order, commonRequest.Products)
+	cart := t.buildCart(commonRequest.Products, order != nil)
+
 	// Restore cart from user attributes if available
-	var cart interface{}
-	if cartData, exists := commonRequest.User.Attributes["cart"]; exists {
-		cart = cartData
+	if cartData, exists := commonRequest.User.Attributes["cart"]; exists && cart == nil {
+		legacyCart := &IsEventCart{}
+		if err := remarshal(cartData, legacyCart); err == nil {
+			cart = legacyCart
+		}
 	}
 
 	// Build isEvent.device from device
@@ -462,43 +760,143 @@ func (t *CommonToUOTranslator) buildIsEvent(commonRequest *CommonRequestFormat)
 		}
 	}
 
-	return IsEventContext{
+	isEvent := IsEventContext{
 		Source:     source,
 		User:       user,
 		Flags:      flags,
 		Action:     action,
 		ItemAction: itemAction,
-		Catalog:    catalog,
+		Catalog:    &catalog,
 		Cart:       cart,
+		Order:      order,
 		Device:     device,
 		Timestamp:  commonRequest.Timestamp,
 	}
+
+	// Restore unmapped fields captured on the way in
+	if commonRequest.Extensions != nil && commonRequest.Extensions.UO != nil {
+		t.restoreExtensions(&isEvent, commonRequest, commonRequest.Extensions.UO)
+	}
+
+	// The consent section is authoritative for the consent flag
+	if commonRequest.Consent != nil {
+		isEvent.User.Attributes.CustomerNonConsent = !commonRequest.Consent.Granted
+	}
+
+	return isEvent
 }
 
-func (t *CommonToUOTranslator) buildUserAttributes(user UserContext) IsEventUserAttributes {
+func (t *CommonToUOTranslator) restoreExtensions(isEvent *IsEventContext, commonRequest *CommonRequestFormat, ext *UOExtensions) {
+	isEvent.Source.Channel = ext.Channel
+
+	// Keep the original locale spelling unless the common locale has changed since
+	originalLocale := (&UOToCommonTranslator{Mappings: t.Mappings}).extractPage(&IsEventSource{Locale: ext.Locale})
+	if originalLocale.Locale == commonRequest.Page.Locale || commonRequest.Page.Locale == "" {
+		isEvent.Source.Locale = ext.Locale
+	}
+
+	// Keep the original page type unless the common page type has changed since
+	original := (&UOToCommonTranslator{Mappings: t.Mappings}).extractPage(&IsEventSource{PageType: ext.PageType, URL: commonRequest.Page.URL})
+	if original.Type == commonRequest.Page.Type {
+		isEvent.Source.PageType = ext.PageType
+	}
+
+	isEvent.User.Attributes = t.buildUserAttributesFrom(ext.UserAttributes, commonRequest.User)
+	isEvent.Unmapped = ext.Unmapped[uoPathIsEvent]
+	isEvent.Source.Unmapped = ext.Unmapped[uoPathSource]
+	isEvent.User.Unmapped = ext.Unmapped[uoPathUser]
+	isEvent.Flags = ext.Flags
+	isEvent.ItemAction = commonRequest.Event.ItemAction
+	if isEvent.Cart == nil {
+		isEvent.Cart = ext.EmptyCart
+	}
+
+	// Products and the page category stay authoritative for the catalog, which stays
+	// absent if the request had none and nothing has been added to it
+	built := t.buildCatalog(commonRequest.Products, &commonRequest.Page)
+	switch {
+	case ext.Catalog != nil:
+		catalog := *ext.Catalog
+		catalog.Product = built.Product
+		if built.Category != nil {
+			catalog.Category = built.Category
+		}
+		isEvent.Catalog = &catalog
+	case built.Product == nil && built.Category == nil:
+		isEvent.Catalog = nil
+	default:
+		isEvent.Catalog = &built
+	}
+
+	// Device type and platform may have been derived on the way in; restore the original
+	// device with the user agent and IP of the common device
+	if ext.Device != nil {
+		device := *ext.Device
+		device.UserAgent = commonRequest.Device.UserAgent
+		device.IP = commonRequest.Device.IP
+		isEvent.Device = &device
+	} else if commonRequest.Device.UserAgent == "" && commonRequest.Device.IP == "" {
+		isEvent.Device = nil
+	}
+
+	if ext.TimestampGenerated {
+		isEvent.Timestamp = ""
+	}
+}
+
+func (t *CommonToUOTranslator) buildUserAttributes(commonRequest *CommonRequestFormat) IsEventUserAttributes {
+	user := commonRequest.User
+	geo := commonRequest.Geo
+
 	// Map user type to auth status
 	authStatus := "GUEST"
 	if user.Type == "member" {
 		authStatus = "AUTHORIZED"
 	}
 
+	defaults := &t.config().Defaults
 	attributes := IsEventUserAttributes{
 		CustomerAuthStatus:             authStatus,
 		CustomerIsEmployee:             false,   // Default
 		CustomerDeliveryPassMbr:        false,   // Default
 		CustomerNonConsent:             false,   // Default
-		Locale:                         "en_US", // Default
+		Locale:                         t.sourceLocale(&commonRequest.Page),
 		URBNIsLoyalty:                  user.Type == "member",
 		TierStatus:                     "",      // Default
 		CustomerNotificationPermission: "default",
-		URBNMbrA:                       false, // Default
-		URBNMbrB:                       false, // Default
-		URBNMbrMarketA:                 false, // Default
-		URBNMbrMarketB:                 false, // Default
-		CountryCode:                    "US",  // Default
-		Email:                          user.Email,
-		Segments:                       user.Segments,
+		URBNMbrA:                       new(bool), // Default false
+		URBNMbrB:                       new(bool), // Default false
+		URBNMbrMarketA:                 new(bool), // Default false
+		URBNMbrMarketB:                 new(bool), // Default false
+		CountryCode:                    defaults.CountryCode,
+	}
+
+	attributes.CustomerID = commonRequest.Identity.Value(NamespaceCustomer)
+
+	// The user's market, unless the user attributes name one
+	if geo != nil {
+		if geo.CountryCode != "" {
+			attributes.CountryCode = geo.CountryCode
+		}
+		attributes.RegionCode = geo.RegionCode
+	}
+
+	return t.buildUserAttributesFrom(attributes, user)
+}
+
+// sourceLocale returns the UO form of the page locale, else the default locale
+func (t *CommonToUOTranslator) sourceLocale(page *PageContext) string {
+	if locale := uoLocale(page.Locale); locale != "" {
+		return locale
 	}
+	return t.config().Defaults.Locale
+}
+
+// buildUserAttributesFrom applies the common user onto base attributes, either defaults or
+// the original attributes preserved in the UO extensions
+func (t *CommonToUOTranslator) buildUserAttributesFrom(attributes IsEventUserAttributes, user UserContext) IsEventUserAttributes {
+	attributes.Email = user.Email
+	attributes.Segments = user.Segments
 
 	// Restore preserved attributes from user.Attributes
 	if user.Attributes != nil {
@@ -552,11 +950,16 @@ func (t *CommonToUOTranslator) buildUserAttributes(user UserContext) IsEventUser
 	return attributes
 }
 
-func (t *CommonToUOTranslator) buildCatalog(products []ProductContext) IsEventCatalog {
+func (t *CommonToUOTranslator) buildCatalog(products []ProductContext, page *PageContext) IsEventCatalog {
 	catalog := IsEventCatalog{}
 
-	if len(products) > 0 {
-		product := products[0] // UO typically handles single product
+	// The UO category is the leaf of the category path
+	if len(page.CategoryPath) > 0 {
+		catalog.Category = &IsEventCategory{ID: page.CategoryPath[len(page.CategoryPath)-1]}
+	}
+
+	if viewed := productsWithRole(products, ProductRoleViewed); len(viewed) > 0 {
+		product := viewed[0] // The UO catalog holds a single product
 		catalog.Product = &IsEventProduct{
 			ID:         product.ID,
 			Name:       product.Name,
@@ -571,75 +974,90 @@ func (t *CommonToUOTranslator) buildCatalog(products []ProductContext) IsEventCa
 	return catalog
 }
 
-func (t *CommonToUOTranslator) mapPageType(commonPageType string) string {
-	// Map common page types to UO page types
-	pageTypeMapping := map[string]string{
-		"homepage": "home", // UO uses "home" for homepage
-		"product":  "product",
-		"category": "category",
-		"cart":     "Cart", // UO uses capital C
-		"checkout": "checkout",
-		"search":   "search",
-		"other":    "content",
+// buildCart rebuilds the cart from in-cart products, and from purchased products too when
+// there is no order to hold them
+func (t *CommonToUOTranslator) buildCart(products []ProductContext, hasOrder bool) *IsEventCart {
+	roles := []string{ProductRoleInCart}
+	if !hasOrder {
+		roles = append(roles, ProductRolePurchased)
 	}
 
-	if uoPageType, exists := pageTypeMapping[commonPageType]; exists {
+	items := buildCartItems(productsWithRole(products, roles...))
+	if len(items) == 0 {
+		return nil
+	}
+	return &IsEventCart{Complete: &IsEventCartContents{Product: items}}
+}
+
+func (t *CommonToUOTranslator) buildOrder(order *OrderContext, products []ProductContext) *IsEventOrder {
+	if order == nil {
+		return nil
+	}
+
+	details := &IsEventOrderDetails{
+		OrderID:    order.ID,
+		TotalValue: order.Revenue,
+		Currency:   order.Currency,
+		LineItems:  buildCartItems(productsWithRole(products, ProductRolePurchased)),
+	}
+	for _, discount := range order.Discounts {
+		details.Discounts = append(details.Discounts, IsEventDiscount{Code: discount.Code, Amount: discount.Amount})
+	}
+
+	return &IsEventOrder{Product: details}
+}
+
+func buildCartItems(products []ProductContext) []IsEventCartItem {
+	var items []IsEventCartItem
+	for _, product := range products {
+		items = append(items, IsEventCartItem{
+			ID:       product.ID,
+			Price:    product.Price,
+			Quantity: product.Quantity,
+		})
+	}
+	return items
+}
+
+func (t *CommonToUOTranslator) mapPageType(commonPageType string) string {
+	// Map common page types to UO page types
+	mappings := t.mappings()
+	if uoPageType, exists := mappings.CommonPageTypeToUO[commonPageType]; exists {
 		return uoPageType
 	}
-	return "content"
+	return mappings.DefaultPageType
 }
 
 func (t *CommonToUOTranslator) mapEventTypeToAction(eventType string) string {
 	// Map common event types to UO actions
-	eventTypeToAction := map[string]string{
-		"page_view":     "Page View",
-		"product_view":  "Product Detail",
-		"add_to_cart":   "Add to Cart",
-		"purchase":      "Purchase",
-		"category_view": "CategoryView",
-		"cart_view":     "Cart",
-		"search":        "Search",
-		"login":         "Login",
-		"signup":        "Signup",
-	}
-
-	if action, exists := eventTypeToAction[eventType]; exists {
+	mappings := t.mappings()
+	if action, exists := mappings.EventTypeToAction[eventType]; exists {
 		return action
 	}
-	return "Page View"
+	return mappings.DefaultAction
 }
 
 func (t *CommonToUOTranslator) mapEventTypeToItemAction(eventType string) string {
 	// Map common event types to UO item actions
-	eventTypeToItemAction := map[string]string{
-		"page_view":     "View Category",
-		"product_view":  "View Product",
-		"add_to_cart":   "Add to Cart",
-		"purchase":      "Purchase",
-		"category_view": "View Category",
-		"cart_view":     "View Cart",
-		"search":        "Search",
-		"login":         "Login",
-		"signup":        "Signup",
-	}
-
-	if itemAction, exists := eventTypeToItemAction[eventType]; exists {
+	mappings := t.mappings()
+	if itemAction, exists := mappings.EventTypeToItemAction[eventType]; exists {
 		return itemAction
 	}
-	return "View Category"
+	return mappings.DefaultItemAction
 }
 
-// Helper function to compare maps (simplified)
+// Helper function to compare maps by their JSON representation
 func (t *CommonToUOTranslator) CompareMaps(map1, map2 map[string]interface{}) bool {
-	if len(map1) != len(map2) {
-		return false
-	}
+	differences, err := DiffJSON(map1, map2)
+	return err == nil && len(differences) == 0
+}
 
-	for key, value1 := range map1 {
-		if value2, exists := map2[key]; !exists || fmt.Sprintf("%v", value1) != fmt.Sprintf("%v", value2) {
-			return false
-		}
-	}
+// UserIdentifier returns the common user ID
+func (r *CommonRequestFormat) UserIdentifier() string {
+	return r.User.ID
+}
 
-	return true
+// UserIdentifier returns the isEvent user ID
+func (r *UOCurrentRequestFormat) UserIdentifier() string {
+	return r.IsEvent.User.ID
 }
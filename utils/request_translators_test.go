@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCartItemsBecomeRoledProducts(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			Action:  "Purchase",
+			Catalog: &IsEventCatalog{Product: &IsEventProduct{ID: "AN-1"}},
+			Cart: &IsEventCart{Complete: &IsEventCartContents{Product: []IsEventCartItem{
+				{ID: "AN-2", Price: 24, Quantity: 2},
+				{ID: "AN-3", Price: 96, Quantity: 1},
+			}}},
+		},
+	}
+
+	common, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roles []string
+	for _, product := range common.Products {
+		roles = append(roles, product.ID+":"+product.Role)
+	}
+	want := []string{"AN-1:viewed", "AN-2:purchased", "AN-3:purchased"}
+	if !reflect.DeepEqual(roles, want) {
+		t.Fatalf("products = %v, want %v", roles, want)
+	}
+
+	// Without extensions the cart and catalog are rebuilt from the products alone
+	common.Extensions = nil
+	back, err := (&CommonToUOTranslator{}).Translate(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.IsEvent.Catalog.Product == nil || back.IsEvent.Catalog.Product.ID != "AN-1" {
+		t.Errorf("catalog product = %+v, want AN-1", back.IsEvent.Catalog.Product)
+	}
+	if !reflect.DeepEqual(back.IsEvent.Cart, uoRequest.IsEvent.Cart) {
+		t.Errorf("cart = %+v, want %+v", back.IsEvent.Cart.Items(), uoRequest.IsEvent.Cart.Items())
+	}
+}
+
+func TestUORoundTripKeepsUnmodeledAndAbsentFields(t *testing.T) {
+	pinClock(t)
+	input := []byte(`{
+		"contentfulEnvironment": "master",
+		"bestMatch": {"country": "US"},
+		"queries": {},
+		"experiment": "holdout",
+		"isEvent": {
+			"source": {"locale": "en_US", "application": "web|other|desktop", "url": "https://www.anthropologie.com/", "channel": "Server", "pageType": "home", "abTest": "b"},
+			"user": {
+				"id": "visitor-1",
+				"cohort": 7,
+				"attributes": {
+					"customer_auth_status": "GUEST", "customer_delivery_pass_mbr": false, "customer_is_employee": false,
+					"customer_non_consent": false, "locale": "en_US", "urbn_is_loyalty": false, "tier_status": "",
+					"countryCode": "US", "sfcrmContactId": "0033g00001fDleMAAS", "urbn_mbr_a": false
+				}
+			},
+			"flags": {"pageView": true},
+			"action": "NavigationView",
+			"device": {"type": "desktop", "screen": {"width": 1440}},
+			"timestamp": "2024-05-01T12:00:00Z",
+			"sequence": 12
+		}
+	}`)
+
+	var uoRequest UOCurrentRequestFormat
+	if err := json.Unmarshal(input, &uoRequest); err != nil {
+		t.Fatal(err)
+	}
+	common, err := (&UOToCommonTranslator{}).Translate(&uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Common travels as JSON between the legs
+	data, err := json.Marshal(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received CommonRequestFormat
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatal(err)
+	}
+	back, err := (&CommonToUOTranslator{}).Translate(&received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(input, &raw); err != nil {
+		t.Fatal(err)
+	}
+	differences, err := DiffJSON(raw, back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) > 0 {
+		t.Errorf("round trip is lossy:\n%s", formatDifferences(differences))
+	}
+}
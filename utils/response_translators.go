@@ -129,4 +129,14 @@ func (t *ISToCommonResponseTranslator) Translate(isResponse *ISResponseFormat) (
 	}
 
 	return commonResponse, nil
-}
\ No newline at end of file
+}
+
+// UserIdentifier returns the common user ID
+func (r *CommonResponseFormat) UserIdentifier() string {
+	return r.UserID
+}
+
+// UserIdentifier returns the IS resolved user ID
+func (r *ISResponseFormat) UserIdentifier() string {
+	return r.ResolvedUserID
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SearchContext - The search a search results page shows
+type SearchContext struct {
+	Query       string            `json:"query,omitempty"`
+	Filters     map[string]string `json:"filters,omitempty"`
+	Sort        string            `json:"sort,omitempty"`
+	SortOrder   string            `json:"sortOrder,omitempty"`
+	ResultCount int               `json:"resultCount,omitempty"`
+	Page        int               `json:"page,omitempty"`
+}
+
+// Contentful query whose slug filter names the page being rendered
+const (
+	shoppingPageQuery   = "shoppingPageContent"
+	shoppingPageSlugKey = "fields.slugs[in]"
+)
+
+// DY page attributes carrying the search. DY has no search page type, so search pages
+// are OTHER pages that carry the keyword.
+const (
+	dySearchQueryAttribute       = "searchQuery"
+	dySearchResultCountAttribute = "searchResultCount"
+)
+
+// extractSearch builds the search context of search pages from the page URL, falling back
+// to the shoppingPageContent query slug (e.g. "search?q=mug") for queries the URL lacks.
+// Other page types, and search pages with nothing to report, have no search context.
+func extractSearch(page *PageContext, queries map[string]interface{}) *SearchContext {
+	if page.Type != "search" {
+		return nil
+	}
+
+	search := &SearchContext{}
+	if info := page.URLInfo; info != nil {
+		search.Query = info.SearchQuery
+		search.Filters = info.Filters
+		search.Sort = info.Sort
+		search.SortOrder = info.SortOrder
+		search.Page = info.Page
+	}
+
+	if search.Query == "" {
+		if info := parsePageURL(shoppingPageSlug(queries)); info != nil && info.PageType == "search" {
+			search.Query = info.SearchQuery
+		}
+	}
+
+	if search.Query == "" && len(search.Filters) == 0 && search.Sort == "" && search.Page == 0 {
+		return nil
+	}
+	return search
+}
+
+// shoppingPageSlug returns the slug the shoppingPageContent query filters on, as a
+// site-relative path
+func shoppingPageSlug(queries map[string]interface{}) string {
+	query, ok := queries[shoppingPageQuery].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	slug, ok := query[shoppingPageSlugKey].(string)
+	if !ok || slug == "" {
+		return ""
+	}
+	return "/" + strings.TrimPrefix(slug, "/")
+}
+
+// addDYSearchAttribute adds the search keyword and result count to DY page attributes, if
+// there is a keyword
+func addDYSearchAttribute(attributes map[string]string, search *SearchContext) map[string]string {
+	if search == nil || search.Query == "" {
+		return attributes
+	}
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	attributes[dySearchQueryAttribute] = search.Query
+	if search.ResultCount > 0 {
+		attributes[dySearchResultCountAttribute] = strconv.Itoa(search.ResultCount)
+	}
+	return attributes
+}
+
+// extractDYSearch reads the search context back from DY page attributes
+func extractDYSearch(attributes map[string]string) *SearchContext {
+	query := attributes[dySearchQueryAttribute]
+	if query == "" {
+		return nil
+	}
+	search := &SearchContext{Query: query}
+	if count, err := strconv.Atoi(attributes[dySearchResultCountAttribute]); err == nil && count > 0 {
+		search.ResultCount = count
+	}
+	return search
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchFromShoppingPageQuery(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		Queries: map[string]interface{}{
+			"shoppingPageContent": map[string]interface{}{"fields.slugs[in]": "search?q=Citrus"},
+		},
+		IsEvent: IsEventContext{
+			Action: "SearchResultsView",
+			Source: IsEventSource{URL: "https://www.urbanoutfitters.com/search?sort=newest&page=3", PageType: "search"},
+		},
+	}
+
+	common, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SearchContext{Query: "Citrus", Sort: "newest", Page: 3}
+	if !reflect.DeepEqual(common.Search, want) {
+		t.Fatalf("search = %+v, want %+v", common.Search, want)
+	}
+
+	dyRequest, err := (&CommonToDYEventTranslator{}).Translate(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := dyRequest.Events[0].Properties
+	if properties.DYType != DYEventTypeSearch || properties.Keywords != "Citrus" {
+		t.Errorf("properties = %+v, want keyword-search-v1 with keywords Citrus", properties)
+	}
+}
+
+func TestSearchReachesDYChooseContext(t *testing.T) {
+	commonRequest := &CommonRequestFormat{
+		Page:   PageContext{Type: "search", URL: "https://www.urbanoutfitters.com/search?q=Citrus"},
+		Search: &SearchContext{Query: "Citrus", ResultCount: 42},
+	}
+
+	dyRequest, err := (&CommonToDYRequestTranslator{}).Translate(commonRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := dyRequest.Context.PageAttributes
+	if dyRequest.Context.Page.Type != DYPageTypeOther || attributes[dySearchQueryAttribute] != "Citrus" || attributes[dySearchResultCountAttribute] != "42" {
+		t.Fatalf("context = %+v, want an OTHER page carrying the keyword and result count", dyRequest.Context)
+	}
+
+	// The keyword makes the OTHER page a search page again
+	dyRequest.Context.Page.Location = ""
+	back, err := (&DYToCommonRequestTranslator{}).Translate(dyRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Page.Type != "search" || back.Search == nil || back.Search.Query != "Citrus" || back.Search.ResultCount != 42 {
+		t.Errorf("page type %q, search %+v, want a search for Citrus with 42 results", back.Page.Type, back.Search)
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionInactivityTimeout is the inactivity after which a visitor's next event starts a
+// new session
+const SessionInactivityTimeout = 30 * time.Minute
+
+// SessionCookies are the cookies carrying a session ID, in preference order: the
+// storefront session, then the DY session
+var SessionCookies = []string{"session_id", "_dyjsession"}
+
+type sessionContextKey struct{}
+
+// WithSessionID returns a context carrying the session ID the caller received with the
+// request, e.g. from a session cookie or header. It takes precedence over the payload.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sessionID)
+}
+
+// SessionIDFromContext returns the session ID set with WithSessionID, if any
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey{}).(string)
+	return sessionID
+}
+
+// SessionTracker - Carries derived sessions across requests: a visitor stays in their
+// session while the gap between their events is under the inactivity timeout. Sessions
+// are forgotten once they have been inactive that long.
+type SessionTracker struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*trackedSession
+	lastPrune time.Time
+}
+
+type trackedSession struct {
+	session  SessionContext
+	lastSeen time.Time
+}
+
+// NewSessionTracker returns a tracker for sessions ending after the given inactivity
+func NewSessionTracker(timeout time.Duration) *SessionTracker {
+	return &SessionTracker{
+		timeout:  timeout,
+		sessions: make(map[string]*trackedSession),
+	}
+}
+
+// Session records activity of the visitor at the given time and returns its session: the
+// visitor's current session if they were active within the timeout, else a new session
+// starting now. Events may arrive slightly out of order; the gap is measured either way.
+func (s *SessionTracker) Session(visitor string, at time.Time) SessionContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.Sub(s.lastPrune) > s.timeout {
+		for visitor, tracked := range s.sessions {
+			if at.Sub(tracked.lastSeen) >= s.timeout {
+				delete(s.sessions, visitor)
+			}
+		}
+		s.lastPrune = at
+	}
+
+	if tracked, exists := s.sessions[visitor]; exists {
+		gap := at.Sub(tracked.lastSeen)
+		if gap < s.timeout && -gap < s.timeout {
+			if gap > 0 {
+				tracked.lastSeen = at
+			}
+			session := tracked.session
+			session.IsNew = false
+			return session
+		}
+	}
+
+	session := newDerivedSession(visitor, at)
+	s.sessions[visitor] = &trackedSession{session: session, lastSeen: at}
+	return session
+}
+
+var activeSessionTracker atomic.Pointer[SessionTracker]
+
+// SetSessionTracker installs the tracker that carries derived sessions across requests.
+// Without one, derived sessions fall back to fixed windows of the inactivity timeout.
+func SetSessionTracker(tracker *SessionTracker) {
+	activeSessionTracker.Store(tracker)
+}
+
+// resolveSession returns the session of an event: the session ID the caller supplied,
+// else one from a session cookie, else the visitor's session derived by the tracker, or
+// from the window the event falls in when there is no tracker. Supplied, cookie and
+// window sessions are ongoing; a tracked session is new on its first event. Events of
+// unknown visitors cannot be told apart, so each starts a session of its own.
+func resolveSession(sessionID, cookieHeader, visitor string, at time.Time) SessionContext {
+	if sessionID != "" {
+		return SessionContext{ID: sessionID}
+	}
+	if sessionID = sessionFromCookies(cookieHeader); sessionID != "" {
+		return SessionContext{ID: sessionID}
+	}
+
+	if visitor == "" {
+		nonce := make([]byte, 16)
+		rand.Read(nonce)
+		return newDerivedSession(hex.EncodeToString(nonce), at)
+	}
+	if tracker := activeSessionTracker.Load(); tracker != nil {
+		return tracker.Session(visitor, at)
+	}
+
+	// Without activity to measure, the events of a visit share a session while they fall
+	// in the same window of the inactivity timeout
+	session := newDerivedSession(visitor, at.UTC().Truncate(SessionInactivityTimeout))
+	session.IsNew = false
+	return session
+}
+
+// newDerivedSession returns a new session of the visitor starting at the given time, its
+// ID derived from both
+func newDerivedSession(visitor string, at time.Time) SessionContext {
+	sum := sha256.Sum256([]byte(visitor + "|" + at.UTC().Format(time.RFC3339Nano)))
+	return SessionContext{
+		ID:        "sess_" + hex.EncodeToString(sum[:10]),
+		IsNew:     true,
+		StartTime: at.UTC().Format(time.RFC3339),
+	}
+}
+
+// sessionFromCookies returns the first session cookie value of a Cookie header
+func sessionFromCookies(cookieHeader string) string {
+	cookies := map[string]string{}
+	for _, pair := range strings.Split(cookieHeader, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && value != "" {
+			cookies[name] = strings.Trim(value, `"`)
+		}
+	}
+	for _, name := range SessionCookies {
+		if value := cookies[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
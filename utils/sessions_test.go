@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveSession(t *testing.T) {
+	at := time.Date(2025, 1, 11, 12, 5, 0, 0, time.UTC)
+
+	if session := resolveSession("from-header", "_dyjsession=from-cookie", "user-1", at); session.ID != "from-header" || session.IsNew {
+		t.Errorf("header session = %+v, want ongoing from-header", session)
+	}
+	if session := resolveSession("", "SS_VARIANT=2; _dyjsession=from-cookie", "user-1", at); session.ID != "from-cookie" || session.IsNew {
+		t.Errorf("cookie session = %+v, want ongoing from-cookie", session)
+	}
+
+	// Without a tracker, a visitor's events share a session within a window
+	first := resolveSession("", "", "user-1", at)
+	if first.IsNew || first.StartTime != "2025-01-11T12:00:00Z" {
+		t.Errorf("derived session = %+v, want ongoing, starting at the window", first)
+	}
+	if second := resolveSession("", "", "user-1", at.Add(20*time.Minute)); second.ID != first.ID {
+		t.Errorf("events in one window: sessions %s and %s, want one", first.ID, second.ID)
+	}
+	if later := resolveSession("", "", "user-1", at.Add(30*time.Minute)); later.ID == first.ID {
+		t.Errorf("events in different windows share session %s", first.ID)
+	}
+	if other := resolveSession("", "", "user-2", at); other.ID == first.ID {
+		t.Errorf("different users share session %s", first.ID)
+	}
+}
+
+func TestResolveSessionUnknownVisitor(t *testing.T) {
+	t.Cleanup(func() { SetSessionTracker(nil) })
+	at := time.Date(2025, 1, 11, 12, 5, 0, 0, time.UTC)
+
+	for _, tracker := range []*SessionTracker{nil, NewSessionTracker(SessionInactivityTimeout)} {
+		SetSessionTracker(tracker)
+		first := resolveSession("", "", "", at)
+		second := resolveSession("", "", "", at)
+		if first.ID == "" || first.ID == second.ID || !first.IsNew {
+			t.Errorf("tracker %v: unknown visitors' sessions %+v and %+v, want new ones of their own", tracker != nil, first, second)
+		}
+		if tracker != nil && len(tracker.sessions) != 0 {
+			t.Errorf("unknown visitors tracked: %d sessions", len(tracker.sessions))
+		}
+	}
+}
+
+func TestSessionTrackerMarksFirstEventNew(t *testing.T) {
+	SetSessionTracker(NewSessionTracker(SessionInactivityTimeout))
+	t.Cleanup(func() { SetSessionTracker(nil) })
+
+	at := time.Date(2025, 1, 11, 12, 5, 0, 0, time.UTC)
+	if session := resolveSession("", "", "user-1", at); !session.IsNew {
+		t.Errorf("first event: session = %+v, want new", session)
+	}
+	if session := resolveSession("", "", "user-1", at.Add(time.Minute)); session.IsNew {
+		t.Errorf("second event: session = %+v, want ongoing", session)
+	}
+}
+
+func TestSessionTrackerInactivityWindow(t *testing.T) {
+	SetSessionTracker(NewSessionTracker(SessionInactivityTimeout))
+	t.Cleanup(func() { SetSessionTracker(nil) })
+
+	// A visit crossing the half hour stays one session
+	at := time.Date(2025, 1, 11, 12, 29, 30, 0, time.UTC)
+	first := resolveSession("", "", "user-1", at)
+	second := resolveSession("", "", "user-1", at.Add(time.Minute))
+	if second.ID != first.ID || second.IsNew || second.StartTime != first.StartTime {
+		t.Errorf("events a minute apart across 12:30: %+v then %+v, want one session", first, second)
+	}
+
+	// Activity extends the session past the timeout from its start
+	third := resolveSession("", "", "user-1", at.Add(25*time.Minute))
+	fourth := resolveSession("", "", "user-1", at.Add(50*time.Minute))
+	if third.ID != first.ID || fourth.ID != first.ID {
+		t.Errorf("active visit split: %s, %s, %s", first.ID, third.ID, fourth.ID)
+	}
+
+	// Inactivity ends it
+	later := resolveSession("", "", "user-1", at.Add(50*time.Minute+SessionInactivityTimeout))
+	if later.ID == first.ID || !later.IsNew {
+		t.Errorf("session after inactivity = %+v, want a new one", later)
+	}
+
+	if other := resolveSession("", "", "user-2", at.Add(time.Minute)); other.ID == first.ID || !other.IsNew {
+		t.Errorf("other visitor's session = %+v, want a new one of their own", other)
+	}
+}
+
+func TestExtractSessionAnonymousWithoutDevice(t *testing.T) {
+	translator := &UOToCommonTranslator{}
+	timestamp := "2025-01-11T12:05:00Z"
+
+	// Anonymous events with no device information must not share a session
+	first := translator.extractSession(&UOCurrentRequestFormat{}, &DeviceContext{}, timestamp)
+	second := translator.extractSession(&UOCurrentRequestFormat{}, &DeviceContext{}, timestamp)
+	if first.ID == second.ID {
+		t.Errorf("anonymous events without a device share session %s", first.ID)
+	}
+
+	// Anonymous events from one device do
+	device := &DeviceContext{IP: "203.0.113.7", UserAgent: "Mozilla/5.0"}
+	first = translator.extractSession(&UOCurrentRequestFormat{}, device, timestamp)
+	second = translator.extractSession(&UOCurrentRequestFormat{}, device, timestamp)
+	if first.ID != second.ID {
+		t.Errorf("anonymous events from one device: sessions %s and %s, want one", first.ID, second.ID)
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URLInfo - Storefront data derived from a page URL
+type URLInfo struct {
+	// PageType is the common page type the URL path implies
+	PageType     string            `json:"pageType,omitempty"`
+	SearchQuery  string            `json:"searchQuery,omitempty"`
+	CategorySlug string            `json:"categorySlug,omitempty"`
+	ProductSlug  string            `json:"productSlug,omitempty"`
+	ColorCode    string            `json:"colorCode,omitempty"`
+	MerchClass   string            `json:"merchClass,omitempty"`
+	Sort         string            `json:"sort,omitempty"`
+	SortOrder    string            `json:"sortOrder,omitempty"`
+	Page         int               `json:"page,omitempty"`
+	Filters      map[string]string `json:"filters,omitempty"`
+}
+
+// Query parameters that describe the page rather than filter it
+var urlNavigationParams = map[string]bool{
+	"ref":          true,
+	"brand-switch": true,
+	"quantity":     true,
+	"type":         true,
+}
+
+// ParseStorefrontURL extracts the page type, search query, category and product slugs,
+// color code, merch class, sort, page number and filters from a storefront URL. Both
+// absolute URLs and site-relative paths are accepted. Storefront paths follow these
+// patterns:
+//
+//	/                               homepage
+//	/search?q=<query>               search
+//	/shop/<product>?category=&color=&merchClass=
+//	                                product
+//	/cart, /checkout/...            cart, checkout
+//	/<category>?<filters>           category
+func ParseStorefrontURL(rawURL string) (*URLInfo, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	info := &URLInfo{}
+	query := parsed.Query()
+
+	switch {
+	case len(segments) == 0:
+		info.PageType = "homepage"
+	case segments[0] == "search":
+		info.PageType = "search"
+		info.SearchQuery = strings.TrimSpace(query.Get("q"))
+	case segments[0] == "shop" && len(segments) > 1:
+		info.PageType = "product"
+		info.ProductSlug = segments[1]
+		info.CategorySlug = query.Get("category")
+	case segments[0] == "cart":
+		info.PageType = "cart"
+	case segments[0] == "checkout":
+		info.PageType = "checkout"
+	case len(segments) == 1:
+		info.PageType = "category"
+		info.CategorySlug = segments[0]
+	default:
+		info.PageType = "other"
+	}
+
+	info.ColorCode = query.Get("color")
+	info.MerchClass = query.Get("merchClass")
+	info.Sort = query.Get("sort")
+	info.SortOrder = query.Get("order")
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		info.Page = page
+	}
+
+	for name, values := range query {
+		switch name {
+		case "q", "category", "color", "merchClass", "sort", "order", "page":
+			continue
+		}
+		if urlNavigationParams[name] || len(values) == 0 {
+			continue
+		}
+		if info.Filters == nil {
+			info.Filters = make(map[string]string)
+		}
+		info.Filters[name] = strings.Join(values, ",")
+	}
+
+	return info, nil
+}
+
+// parsePageURL parses a page URL for the common format, returning nil for empty or
+// malformed URLs
+func parsePageURL(rawURL string) *URLInfo {
+	if rawURL == "" {
+		return nil
+	}
+	info, err := ParseStorefrontURL(rawURL)
+	if err != nil {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStorefrontURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want URLInfo
+	}{
+		{"https://www.urbanoutfitters.com/?ref=logo", URLInfo{PageType: "homepage"}},
+		{"/search?q=%20citrus%20", URLInfo{PageType: "search", SearchQuery: "citrus"}},
+		{
+			"https://www.urbanoutfitters.com/shop/uo-oval-sunglasses?category=all-sunglasses&color=020&merchClass=0158&type=STANDARD&quantity=1",
+			URLInfo{PageType: "product", ProductSlug: "uo-oval-sunglasses", CategorySlug: "all-sunglasses", ColorCode: "020", MerchClass: "0158"},
+		},
+		{
+			"/dresses/?sort=price&order=asc&sleevelength=short&length=midi&length=maxi",
+			URLInfo{PageType: "category", CategorySlug: "dresses", Sort: "price", SortOrder: "asc", Filters: map[string]string{"sleevelength": "short", "length": "midi,maxi"}},
+		},
+		{"/cart/", URLInfo{PageType: "cart"}},
+		{"/checkout/confirmation", URLInfo{PageType: "checkout"}},
+		{"/help/returns", URLInfo{PageType: "other"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStorefrontURL(tt.url)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.url, *got, tt.want)
+		}
+	}
+}
+
+func TestURLFillsUnknownPageType(t *testing.T) {
+	uoRequest := &UOCurrentRequestFormat{
+		IsEvent: IsEventContext{
+			Action: "Page View",
+			Source: IsEventSource{URL: "https://www.urbanoutfitters.com/search?q=citrus", PageType: "plp-v2"},
+		},
+	}
+
+	common, err := (&UOToCommonTranslator{}).Translate(uoRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.Page.Type != "search" {
+		t.Errorf("page type = %q, want search", common.Page.Type)
+	}
+
+	// The unknown UO page type survives the round trip through the extensions
+	back, err := (&CommonToUOTranslator{}).Translate(common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.IsEvent.Source.PageType != "plp-v2" {
+		t.Errorf("round-trip page type = %q, want plp-v2", back.IsEvent.Source.PageType)
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"strings"
+)
+
+// Common device types
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+)
+
+// UserAgentInfo - What a user agent string says about the client
+type UserAgentInfo struct {
+	DeviceType string
+	Browser    string
+	OS         string
+	Bot        bool
+}
+
+// userAgentToken pairs a user agent substring with the name it identifies
+type userAgentToken struct {
+	token string
+	name  string
+}
+
+// Browsers in match order: Chromium-based browsers also announce Chrome and Safari, and
+// Chrome announces Safari, so the more specific tokens come first
+var userAgentBrowsers = []userAgentToken{
+	{"Edg/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"Trident/", "Internet Explorer"},
+	{"MSIE ", "Internet Explorer"},
+}
+
+// Operating systems in match order: Android and Chrome OS announce Linux, and iOS
+// announces Mac OS X
+var userAgentOSes = []userAgentToken{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "Chrome OS"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Lowercase substrings of crawlers, monitors and HTTP libraries
+var userAgentBotTokens = []string{
+	"bot", "crawler", "spider", "slurp", "headlesschrome", "lighthouse", "pingdom",
+	"facebookexternalhit", "curl/", "wget/", "python-requests", "go-http-client", "java/",
+}
+
+// ClassifyUserAgent derives the device type, browser, OS and bot flag from a user agent
+// string. Parts it cannot tell are left empty.
+func ClassifyUserAgent(userAgent string) UserAgentInfo {
+	info := UserAgentInfo{
+		Browser: matchUserAgentToken(userAgent, userAgentBrowsers),
+		OS:      matchUserAgentToken(userAgent, userAgentOSes),
+	}
+
+	lower := strings.ToLower(userAgent)
+	for _, token := range userAgentBotTokens {
+		if strings.Contains(lower, token) {
+			info.Bot = true
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(lower, "tablet"):
+		info.DeviceType = DeviceTypeTablet
+	case info.OS == "Android" && !strings.Contains(userAgent, "Mobile"):
+		info.DeviceType = DeviceTypeTablet
+	case strings.Contains(userAgent, "Mobi") || info.OS == "iOS" || info.OS == "Android":
+		info.DeviceType = DeviceTypeMobile
+	case info.OS != "":
+		info.DeviceType = DeviceTypeDesktop
+	}
+
+	return info
+}
+
+func matchUserAgentToken(userAgent string, tokens []userAgentToken) string {
+	for _, candidate := range tokens {
+		if strings.Contains(userAgent, candidate.token) {
+			return candidate.name
+		}
+	}
+	return ""
+}
+
+// parseApplication splits a UO source.application triplet such as "web|other|desktop"
+// into platform, OS and device type. "other" and "unknown" parts are left empty.
+func parseApplication(application string) (platform, os, deviceType string) {
+	parts := strings.Split(application, "|")
+	if len(parts) != 3 {
+		return "", "", ""
+	}
+	for i, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "other" || part == "unknown" {
+			part = ""
+		}
+		parts[i] = part
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// classifyDevice fills the device type, browser, OS and bot flag the device does not
+// already carry from its user agent, then from the application triplet
+func classifyDevice(device *DeviceContext, application string) {
+	info := ClassifyUserAgent(device.UserAgent)
+	_, applicationOS, applicationType := parseApplication(application)
+
+	device.Type = firstNonEmpty(device.Type, info.DeviceType, applicationType)
+	device.Browser = firstNonEmpty(device.Browser, info.Browser)
+	device.OS = firstNonEmpty(device.OS, info.OS, applicationOS)
+	device.Bot = device.Bot || info.Bot
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
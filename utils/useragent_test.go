@@ -0,0 +1,53 @@
+package utils
+
+import "testing"
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      UserAgentInfo
+	}{
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			UserAgentInfo{DeviceType: DeviceTypeDesktop, Browser: "Chrome", OS: "macOS"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			UserAgentInfo{DeviceType: DeviceTypeMobile, Browser: "Safari", OS: "iOS"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			UserAgentInfo{DeviceType: DeviceTypeTablet, Browser: "Chrome", OS: "Android"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			UserAgentInfo{DeviceType: DeviceTypeDesktop, Browser: "Edge", OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgentInfo{Bot: true},
+		},
+		{"", UserAgentInfo{}},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyUserAgent(tt.userAgent); got != tt.want {
+			t.Errorf("%q:\n got %+v\nwant %+v", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestApplicationTripletFillsDevice(t *testing.T) {
+	device := DeviceContext{}
+	classifyDevice(&device, "web|other|desktop")
+	if device.Type != DeviceTypeDesktop || device.OS != "" {
+		t.Errorf("device = %+v, want desktop with no OS", device)
+	}
+
+	// The user agent wins over the triplet
+	device = DeviceContext{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) Mobile/15E148"}
+	classifyDevice(&device, "web|other|desktop")
+	if device.Type != DeviceTypeMobile || device.OS != "iOS" {
+		t.Errorf("device = %+v, want mobile iOS", device)
+	}
+}